@@ -0,0 +1,333 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheKeyPrefix is the default prefix of the cache keys written by Wechat.
+const DefaultCacheKeyPrefix = "wechat"
+
+const (
+	cacheKindAccessToken = "access_token"
+	cacheKindJsTicket    = "jsapi_ticket"
+	cacheKindCardTicket  = "wx_card_ticket"
+)
+
+// legacyCacheKeys maps cache kinds to the keys used before keys were namespaced.
+var legacyCacheKeys = map[string]string{
+	cacheKindAccessToken: "AccessToken",
+	cacheKindJsTicket:    "JsTicket",
+}
+
+type cacheKeys struct {
+	prefix string
+	appID  string
+	legacy bool
+}
+
+// key returns the namespaced cache key for kind, "<prefix>:<appid>:<kind>".
+func (k cacheKeys) key(kind string) string {
+	if k.prefix == "" {
+		return k.appID + ":" + kind
+	}
+	return k.prefix + ":" + k.appID + ":" + kind
+}
+
+func (w *Wechat) cacheGet(ctx context.Context, kind string) (string, bool, error) {
+	value, exist, err := w.cache.Get(ctx, w.keys.key(kind))
+	if err != nil || exist {
+		return value, exist, err
+	}
+	if legacy, ok := legacyCacheKeys[kind]; ok && w.keys.legacy {
+		return w.cache.Get(ctx, legacy)
+	}
+	return "", false, nil
+}
+
+func (w *Wechat) cacheSet(ctx context.Context, kind string, value string, ttl time.Duration) error {
+	err := w.cache.SetWithTTL(ctx, w.keys.key(kind), value, ttl)
+	if err != nil {
+		return err
+	}
+	if legacy, ok := legacyCacheKeys[kind]; ok && w.keys.legacy {
+		return w.cache.SetWithTTL(ctx, legacy, value, ttl)
+	}
+	return nil
+}
+
+// cacheGetRefreshed reads a token or ticket with the lifetime stored next to it by
+// cacheSetRefreshed. The lifetime is zero when it was not stored, e.g. for legacy keys.
+func (w *Wechat) cacheGetRefreshed(ctx context.Context, kind string) (*refreshResult, bool, error) {
+	value, exist, err := w.cacheGet(ctx, kind)
+	if err != nil || !exist {
+		return nil, exist, err
+	}
+	result := &refreshResult{value: value}
+	lifetime, ok, err := w.cache.Get(ctx, w.keys.key(kind+":lifetime"))
+	if err == nil && ok {
+		issued, expires, found := strings.Cut(lifetime, " ")
+		issuedAt, err1 := strconv.ParseInt(issued, 10, 64)
+		expiresAt, err2 := strconv.ParseInt(expires, 10, 64)
+		if found && err1 == nil && err2 == nil {
+			result.issuedAt, result.expiresAt = time.UnixMilli(issuedAt), time.UnixMilli(expiresAt)
+		}
+	}
+	return result, true, nil
+}
+
+// cacheSetRefreshed caches a token or ticket obtained now that expires after expiresIn,
+// together with its lifetime, so that replicas reading it back know when it is due.
+func (w *Wechat) cacheSetRefreshed(ctx context.Context, kind string, value string, expiresIn time.Duration) *refreshResult {
+	result := &refreshResult{value: value, issuedAt: time.Now()}
+	result.expiresAt = result.issuedAt.Add(expiresIn)
+	ttl := expiresIn - 2*time.Second // 提前2秒过期，避免在过期时请求失败
+	if ttl <= 0 {
+		return result // about to expire, and caches keep a non-positive TTL forever
+	}
+	err := w.cacheSet(ctx, kind, value, ttl)
+	if err == nil {
+		lifetime := strconv.FormatInt(result.issuedAt.UnixMilli(), 10) + " " + strconv.FormatInt(result.expiresAt.UnixMilli(), 10)
+		_ = w.cache.SetWithTTL(ctx, w.keys.key(kind+":lifetime"), lifetime, ttl)
+	}
+	return result
+}
+
+var (
+	_ Cache   = (*MemoryCache)(nil)
+	_ Cache   = (*FileCache)(nil)
+	_ Counter = (*MemoryCache)(nil)
+	_ Counter = (*FileCache)(nil)
+)
+
+type cacheEntry struct {
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"` // zero means no expiry
+}
+
+func newCacheEntry(value string, ttl time.Duration) cacheEntry {
+	entry := cacheEntry{Value: value}
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+	return entry
+}
+
+func (e cacheEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// MemoryCache is a concurrency-safe in-memory Cache with per-key TTL.
+// Expired entries are never returned and are removed by a periodic sweep.
+type MemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewMemoryCache creates a MemoryCache that sweeps expired entries every sweepInterval.
+// A non-positive sweepInterval disables sweeping; expired entries are then only dropped on access.
+// Call Close to stop the sweeper.
+func NewMemoryCache(sweepInterval time.Duration) *MemoryCache {
+	c := &MemoryCache{
+		entries: make(map[string]cacheEntry),
+		stop:    make(chan struct{}),
+	}
+	if sweepInterval > 0 {
+		go c.sweepLoop(sweepInterval)
+	}
+	return c
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, bool, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok {
+		return "", false, nil
+	}
+	if entry.expired(time.Now()) {
+		c.mu.Lock()
+		if current, ok := c.entries[key]; ok && current.expired(time.Now()) {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		return "", false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// SetWithTTL stores value under key. A non-positive ttl stores the value without expiry.
+func (c *MemoryCache) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = newCacheEntry(value, ttl)
+	return nil
+}
+
+// IncrWithTTL atomically adds delta to the integer stored under key.
+func (c *MemoryCache) IncrWithTTL(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		entry = newCacheEntry("0", ttl)
+	}
+	n, err := strconv.ParseInt(entry.Value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	n += delta
+	entry.Value = strconv.FormatInt(n, 10)
+	c.entries[key] = entry
+	return n, nil
+}
+
+// Len returns the number of stored entries, including expired ones not yet swept.
+func (c *MemoryCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// Close stops the background sweeper.
+func (c *MemoryCache) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	return nil
+}
+
+func (c *MemoryCache) sweep() {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if entry.expired(now) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *MemoryCache) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.sweep()
+		}
+	}
+}
+
+// FileCache is a Cache persisted as a JSON file, so that tokens survive restarts of
+// short-lived processes such as CLI tools. Every write rewrites the file atomically.
+// It is safe for concurrent use within one process but not across processes.
+type FileCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]cacheEntry
+}
+
+// NewFileCache opens the cache stored at path, creating it on first write.
+func NewFileCache(path string) (*FileCache, error) {
+	c := &FileCache{
+		path:    path,
+		entries: make(map[string]cacheEntry),
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > 0 {
+		err = json.Unmarshal(raw, &c.entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *FileCache) Get(ctx context.Context, key string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		return "", false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// SetWithTTL stores value under key and persists the cache. A non-positive ttl stores the value without expiry.
+func (c *FileCache) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if entry.expired(now) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = newCacheEntry(value, ttl)
+	return c.save()
+}
+
+// IncrWithTTL adds delta to the integer stored under key and persists the cache.
+func (c *FileCache) IncrWithTTL(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		entry = newCacheEntry("0", ttl)
+	}
+	n, err := strconv.ParseInt(entry.Value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	n += delta
+	entry.Value = strconv.FormatInt(n, 10)
+	c.entries[key] = entry
+	return n, c.save()
+}
+
+func (c *FileCache) save() error {
+	raw, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(c.path)
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	_, err = tmp.Write(raw)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,111 @@
+package wechat
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+)
+
+func TestMemoryCache(t *testing.T) {
+	wechattest.RunCacheTests(t, func(t *testing.T) wechattest.Cache {
+		c := NewMemoryCache(10 * time.Millisecond)
+		t.Cleanup(func() {
+			_ = c.Close()
+		})
+		return c
+	})
+}
+
+func TestMemoryCache_Sweep(t *testing.T) {
+	c := NewMemoryCache(10 * time.Millisecond)
+	defer c.Close()
+	_ = c.SetWithTTL(context.Background(), "key", "value", 20*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if n := c.Len(); n != 0 {
+		t.Errorf("expected expired entry to be swept, %d entries left", n)
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	wechattest.RunCacheTests(t, func(t *testing.T) wechattest.Cache {
+		c, err := NewFileCache(filepath.Join(t.TempDir(), "cache.json"))
+		if err != nil {
+			t.Fatalf("failed to create file cache: %v", err)
+		}
+		return c
+	})
+}
+
+func TestFileCache_Persistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "nested", "cache.json")
+	c, err := NewFileCache(path)
+	if err != nil {
+		t.Fatalf("failed to create file cache: %v", err)
+	}
+	err = c.SetWithTTL(ctx, "AccessToken", "token", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to set value: %v", err)
+	}
+	reopened, err := NewFileCache(path)
+	if err != nil {
+		t.Fatalf("failed to reopen file cache: %v", err)
+	}
+	value, ok, _ := reopened.Get(ctx, "AccessToken")
+	if !ok || value != "token" {
+		t.Errorf("expected value to survive reopen, got %q, %v", value, ok)
+	}
+}
+
+func TestWechat_NamespacedCacheKeys(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(0)
+	wx1, srv1 := newTestWechat(t, cache)
+	srv2 := wechattest.NewServer()
+	t.Cleanup(srv2.Close)
+	srv2.AppID = "wxother0000000000"
+	wx2 := NewWechat(Config{AppID: srv2.AppID, AppSecret: srv2.AppSecret}, cache, WithBaseURL(srv2.URL), WithCacheKeyPrefix("tenant"))
+
+	token1, err := wx1.GetAccessToken(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get token for first app: %v", err)
+	}
+	token2, err := wx2.GetAccessToken(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get token for second app: %v", err)
+	}
+	if value, _, _ := cache.Get(ctx, "wechat:"+srv1.AppID+":access_token"); value != token1 {
+		t.Errorf("expected first app token under its namespaced key, got %q", value)
+	}
+	if value, _, _ := cache.Get(ctx, "tenant:"+srv2.AppID+":access_token"); value != token2 {
+		t.Errorf("expected second app token under its prefixed key, got %q", value)
+	}
+}
+
+func TestWechat_LegacyCacheKeys(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(0)
+	_ = cache.SetWithTTL(ctx, "AccessToken", "legacy-token", time.Hour)
+
+	wx, srv := newTestWechat(t, cache, WithLegacyCacheKeys(true))
+	token, err := wx.GetAccessToken(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get token: %v", err)
+	}
+	if token != "legacy-token" {
+		t.Errorf("expected token from legacy key, got %q", token)
+	}
+	token, err = wx.GetAccessToken(ctx, true)
+	if err != nil {
+		t.Fatalf("failed to reload token: %v", err)
+	}
+	if value, _, _ := cache.Get(ctx, "AccessToken"); value != token {
+		t.Errorf("expected refreshed token to be mirrored to the legacy key, got %q", value)
+	}
+	if n := len(srv.Calls("/cgi-bin/token")); n != 1 {
+		t.Errorf("expected one token call, got %d", n)
+	}
+}
@@ -0,0 +1,185 @@
+package wechat
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// DefaultWatermarkMaxAge is the maximum age of a decrypted payload's watermark accepted by the
+// Wechat decrypt helpers unless changed with WithWatermarkMaxAge. Payloads older than this
+// are rejected as possible replays.
+const DefaultWatermarkMaxAge = 10 * time.Minute
+
+var (
+	ErrorInvalidSessionKey    = errors.New("invalid session key")
+	ErrorInvalidIV            = errors.New("invalid iv")
+	ErrorInvalidEncryptedData = errors.New("invalid encrypted data")
+	ErrorInvalidPadding       = errors.New("invalid pkcs7 padding")
+	ErrorWatermarkMismatch    = errors.New("watermark appid mismatch")
+	ErrorWatermarkExpired     = errors.New("watermark expired")
+)
+
+// WithWatermarkMaxAge sets the maximum age of the watermark accepted by DecryptData and the
+// other Wechat decrypt helpers, DefaultWatermarkMaxAge by default. A zero or negative maxAge
+// disables the age check; the AppID is always checked.
+func WithWatermarkMaxAge(maxAge time.Duration) Option {
+	return func(opts *options) {
+		opts.watermarkMaxAge = maxAge
+	}
+}
+
+// Watermark is attached by WeChat to every encrypted open-data payload.
+type Watermark struct {
+	Timestamp int64  `json:"timestamp"` // 敏感数据获取的时间戳
+	AppID     string `json:"appid"`     // 敏感数据归属的 appid
+}
+
+// Verify checks that the watermark belongs to appID and, if maxAge is positive,
+// that it was issued within maxAge of now.
+func (m Watermark) Verify(appID string, maxAge time.Duration, now time.Time) error {
+	if m.AppID != appID {
+		return ErrorWatermarkMismatch
+	}
+	if maxAge > 0 {
+		issued := time.Unix(m.Timestamp, 0)
+		if now.Sub(issued) > maxAge || issued.Sub(now) > maxAge {
+			return ErrorWatermarkExpired
+		}
+	}
+	return nil
+}
+
+type UserInfo struct {
+	OpenID    string    `json:"openId"`
+	NickName  string    `json:"nickName"`
+	Gender    int       `json:"gender"`
+	City      string    `json:"city"`
+	Province  string    `json:"province"`
+	Country   string    `json:"country"`
+	AvatarURL string    `json:"avatarUrl"`
+	UnionID   string    `json:"unionId"`
+	Watermark Watermark `json:"watermark"`
+}
+
+type PhoneNumberInfo struct {
+	PhoneNumber     string    `json:"phoneNumber"`     // 用户绑定的手机号（国外手机号会有区号）
+	PurePhoneNumber string    `json:"purePhoneNumber"` // 没有区号的手机号
+	CountryCode     string    `json:"countryCode"`     // 区号
+	Watermark       Watermark `json:"watermark"`
+}
+
+type ShareInfo struct {
+	OpenGID   string    `json:"openGId"`   // 群对当前小程序的唯一 ID
+	ChatType  int       `json:"chat_type"` // 会话类型，仅 wx.getGroupEnterInfo 返回
+	Watermark Watermark `json:"watermark"`
+}
+
+type RunData struct {
+	StepInfoList []struct {
+		Timestamp int64 `json:"timestamp"` // 时间戳，表示数据对应的时间
+		Step      int   `json:"step"`      // 微信运动步数
+	} `json:"stepInfoList"`
+	Watermark Watermark `json:"watermark"`
+}
+
+// DecryptData decrypts an encryptedData/iv payload produced by the mini-program open-data APIs
+// with the user's session key (AES-128-CBC, PKCS#7 padding) and returns the plaintext JSON.
+// It performs no watermark checks; see Wechat.DecryptData for the checked variant.
+func DecryptData(sessionKey, encryptedData, iv string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil || len(key) != 16 {
+		return nil, ErrorInvalidSessionKey
+	}
+	rawIV, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil || len(rawIV) != aes.BlockSize {
+		return nil, ErrorInvalidIV
+	}
+	data, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, ErrorInvalidEncryptedData
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, rawIV).CryptBlocks(plain, data)
+	return pkcs7Unpad(plain, aes.BlockSize)
+}
+
+// DecryptData decrypts an open-data payload into v and verifies that its watermark
+// belongs to the configured AppID and is no older than the age set with WithWatermarkMaxAge.
+func (w *Wechat) DecryptData(sessionKey, encryptedData, iv string, v any) error {
+	plain, err := DecryptData(sessionKey, encryptedData, iv)
+	if err != nil {
+		return err
+	}
+	var mark struct {
+		Watermark Watermark `json:"watermark"`
+	}
+	err = json.Unmarshal(plain, &mark)
+	if err != nil {
+		return err
+	}
+	err = mark.Watermark.Verify(w.config.AppID, w.watermark, time.Now())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, v)
+}
+
+func (w *Wechat) DecryptUserInfo(sessionKey, encryptedData, iv string) (*UserInfo, error) {
+	return decryptData[UserInfo](w, sessionKey, encryptedData, iv)
+}
+
+func (w *Wechat) DecryptPhoneNumber(sessionKey, encryptedData, iv string) (*PhoneNumberInfo, error) {
+	return decryptData[PhoneNumberInfo](w, sessionKey, encryptedData, iv)
+}
+
+func (w *Wechat) DecryptShareInfo(sessionKey, encryptedData, iv string) (*ShareInfo, error) {
+	return decryptData[ShareInfo](w, sessionKey, encryptedData, iv)
+}
+
+func (w *Wechat) DecryptRunData(sessionKey, encryptedData, iv string) (*RunData, error) {
+	return decryptData[RunData](w, sessionKey, encryptedData, iv)
+}
+
+// VerifyRawData checks the signature returned alongside rawData by wx.getUserInfo,
+// which is sha1(rawData + sessionKey) in lowercase hex.
+func VerifyRawData(rawData, sessionKey, signature string) bool {
+	sum := sha1.Sum([]byte(rawData + sessionKey))
+	expected := hex.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+func decryptData[T any](w *Wechat, sessionKey, encryptedData, iv string) (*T, error) {
+	var result T
+	err := w.DecryptData(sessionKey, encryptedData, iv, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, ErrorInvalidPadding
+	}
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize {
+		return nil, ErrorInvalidPadding
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, ErrorInvalidPadding
+		}
+	}
+	return data[:len(data)-n], nil
+}
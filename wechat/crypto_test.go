@@ -0,0 +1,94 @@
+package wechat
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data), len(data)+n)
+	copy(padded, data)
+	for i := 0; i < n; i++ {
+		padded = append(padded, byte(n))
+	}
+	return padded
+}
+
+func encryptTestData(t *testing.T, sessionKey, iv string, plain []byte) string {
+	t.Helper()
+	key, _ := base64.StdEncoding.DecodeString(sessionKey)
+	rawIV, _ := base64.StdEncoding.DecodeString(iv)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("failed to create cipher: %v", err)
+	}
+	padded := pkcs7Pad(plain, aes.BlockSize)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, rawIV).CryptBlocks(out, padded)
+	return base64.StdEncoding.EncodeToString(out)
+}
+
+func TestWechat_DecryptPhoneNumber(t *testing.T) {
+	sessionKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	iv := base64.StdEncoding.EncodeToString([]byte("fedcba9876543210"))
+	wx := NewWechat(Config{AppID: "wx123"}, &nopCache{})
+
+	plain := fmt.Sprintf(`{"phoneNumber":"+86 13800000000","purePhoneNumber":"13800000000","countryCode":"86","watermark":{"timestamp":%d,"appid":"wx123"}}`, time.Now().Unix())
+	info, err := wx.DecryptPhoneNumber(sessionKey, encryptTestData(t, sessionKey, iv, []byte(plain)), iv)
+	if err != nil {
+		t.Fatalf("failed to decrypt phone number: %v", err)
+	}
+	if info.PurePhoneNumber != "13800000000" || info.Watermark.AppID != "wx123" {
+		t.Errorf("unexpected phone number info: %+v", info)
+	}
+
+	plain = fmt.Sprintf(`{"phoneNumber":"13800000000","watermark":{"timestamp":%d,"appid":"wx456"}}`, time.Now().Unix())
+	_, err = wx.DecryptPhoneNumber(sessionKey, encryptTestData(t, sessionKey, iv, []byte(plain)), iv)
+	if !errors.Is(err, ErrorWatermarkMismatch) {
+		t.Errorf("expected ErrorWatermarkMismatch, got %v", err)
+	}
+
+	plain = fmt.Sprintf(`{"phoneNumber":"13800000000","watermark":{"timestamp":%d,"appid":"wx123"}}`, time.Now().Add(-time.Hour).Unix())
+	_, err = wx.DecryptPhoneNumber(sessionKey, encryptTestData(t, sessionKey, iv, []byte(plain)), iv)
+	if !errors.Is(err, ErrorWatermarkExpired) {
+		t.Errorf("expected ErrorWatermarkExpired, got %v", err)
+	}
+
+	lenient := NewWechat(Config{AppID: "wx123"}, &nopCache{}, WithWatermarkMaxAge(2*time.Hour))
+	_, err = lenient.DecryptPhoneNumber(sessionKey, encryptTestData(t, sessionKey, iv, []byte(plain)), iv)
+	if err != nil {
+		t.Errorf("expected the watermark to be accepted with a longer max age, got %v", err)
+	}
+	unchecked := NewWechat(Config{AppID: "wx123"}, &nopCache{}, WithWatermarkMaxAge(0))
+	_, err = unchecked.DecryptPhoneNumber(sessionKey, encryptTestData(t, sessionKey, iv, []byte(plain)), iv)
+	if err != nil {
+		t.Errorf("expected the age check to be disabled, got %v", err)
+	}
+
+	otherKey := base64.StdEncoding.EncodeToString([]byte("ffffffffffffffff"))
+	_, err = DecryptData(otherKey, encryptTestData(t, sessionKey, iv, []byte(plain)), iv)
+	if err == nil {
+		t.Error("expected error when decrypting with the wrong session key")
+	}
+}
+
+func TestVerifyRawData(t *testing.T) {
+	rawData := `{"nickName":"Band","gender":1}`
+	sessionKey := "HyVFkGl5F5OQWJZZaNzBBg=="
+	sum := sha1.Sum([]byte(rawData + sessionKey))
+	signature := hex.EncodeToString(sum[:])
+	if !VerifyRawData(rawData, sessionKey, signature) {
+		t.Error("expected signature to verify")
+	}
+	if VerifyRawData(rawData+" ", sessionKey, signature) {
+		t.Error("expected tampered rawData to fail verification")
+	}
+}
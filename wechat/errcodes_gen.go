@@ -0,0 +1,222 @@
+// Code generated by errcodegen from errcodes.csv. DO NOT EDIT.
+
+package wechat
+
+import "errors"
+
+const (
+	// ErrCodeSystemBusy -1 系统繁忙，此时请开发者稍候再试
+	ErrCodeSystemBusy = -1
+	// ErrCodeInvalidCredential 40001 获取 access_token 时 AppSecret 错误，或者 access_token 无效
+	ErrCodeInvalidCredential = 40001
+	// ErrCodeInvalidGrantType 40002 不合法的凭证类型
+	ErrCodeInvalidGrantType = 40002
+	// ErrCodeInvalidOpenID 40003 不合法的 OpenID，请开发者确认 OpenID 是否已关注公众号，或是否是其他公众号的 OpenID
+	ErrCodeInvalidOpenID = 40003
+	// ErrCodeInvalidAppID 40013 不合法的 AppID，请开发者检查 AppID 的正确性，避免异常字符，注意大小写
+	ErrCodeInvalidAppID = 40013
+	// ErrCodeInvalidAccessToken 40014 不合法的 access_token，请开发者认真比对 access_token 的有效性（如是否过期），或查看是否正在为恰当的公众号调用接口
+	ErrCodeInvalidAccessToken = 40014
+	// ErrCodeInvalidCode 40029 无效的 oauth_code 或 js_code
+	ErrCodeInvalidCode = 40029
+	// ErrCodeInvalidRefreshToken 40030 不合法的 refresh_token
+	ErrCodeInvalidRefreshToken = 40030
+	// ErrCodeInvalidTemplateID 40037 不合法的 template_id
+	ErrCodeInvalidTemplateID = 40037
+	// ErrCodeInvalidURL 40048 无效的 url
+	ErrCodeInvalidURL = 40048
+	// ErrCodeInvalidRequestURL 40066 不合法的 URL
+	ErrCodeInvalidRequestURL = 40066
+	// ErrCodeInvalidArgs 40097 参数错误
+	ErrCodeInvalidArgs = 40097
+	// ErrCodeInvalidAppSecret 40125 不合法的 AppSecret
+	ErrCodeInvalidAppSecret = 40125
+	// ErrCodeCodeBeenUsed 40163 oauth_code 或 js_code 已被使用
+	ErrCodeCodeBeenUsed = 40163
+	// ErrCodeIPNotInWhitelist 40164 调用接口的 IP 地址不在白名单中，请在接口 IP 白名单中进行设置
+	ErrCodeIPNotInWhitelist = 40164
+	// ErrCodeHighRiskUser 40226 高风险等级用户，小程序登录拦截
+	ErrCodeHighRiskUser = 40226
+	// ErrCodeAccessTokenMissing 41001 缺少 access_token 参数
+	ErrCodeAccessTokenMissing = 41001
+	// ErrCodeAppIDMissing 41002 缺少 appid 参数
+	ErrCodeAppIDMissing = 41002
+	// ErrCodeRefreshTokenMissing 41003 缺少 refresh_token 参数
+	ErrCodeRefreshTokenMissing = 41003
+	// ErrCodeAppSecretMissing 41004 缺少 secret 参数
+	ErrCodeAppSecretMissing = 41004
+	// ErrCodeCodeMissing 41008 缺少 oauth code
+	ErrCodeCodeMissing = 41008
+	// ErrCodeInvalidPage 41030 page 路径不正确，需要保证在现网版本小程序中存在
+	ErrCodeInvalidPage = 41030
+	// ErrCodeAccessTokenExpired 42001 access_token 超时，请检查 access_token 的有效期
+	ErrCodeAccessTokenExpired = 42001
+	// ErrCodeRefreshTokenExpired 42002 refresh_token 超时
+	ErrCodeRefreshTokenExpired = 42002
+	// ErrCodeCodeExpired 42003 oauth_code 超时
+	ErrCodeCodeExpired = 42003
+	// ErrCodeRequireGetMethod 43001 需要 GET 请求
+	ErrCodeRequireGetMethod = 43001
+	// ErrCodeRequirePostMethod 43002 需要 POST 请求
+	ErrCodeRequirePostMethod = 43002
+	// ErrCodeRequireHTTPS 43003 需要 HTTPS 请求
+	ErrCodeRequireHTTPS = 43003
+	// ErrCodeRequireSubscribe 43004 需要接收者关注
+	ErrCodeRequireSubscribe = 43004
+	// ErrCodeUserRefused 43101 用户拒绝接受消息，如果用户之前曾经订阅过，则表示用户取消了订阅关系
+	ErrCodeUserRefused = 43101
+	// ErrCodeAppIDOpenIDMismatch 43104 appid 与 openid 不匹配
+	ErrCodeAppIDOpenIDMismatch = 43104
+	// ErrCodeEmptyPostData 44002 POST 的数据包为空
+	ErrCodeEmptyPostData = 44002
+	// ErrCodeQuotaExceeded 45009 接口调用超过限制
+	ErrCodeQuotaExceeded = 45009
+	// ErrCodeAPIMinuteQuotaReached 45011 API 调用太频繁，请稍候再试
+	ErrCodeAPIMinuteQuotaReached = 45011
+	// ErrCodeReplyTimeLimit 45015 回复时间超过限制
+	ErrCodeReplyTimeLimit = 45015
+	// ErrCodeQrCodeCountLimit 45029 生成码个数总和到达最大个数限制
+	ErrCodeQrCodeCountLimit = 45029
+	// ErrCodeCustomerServiceOutOfLimit 45047 客服接口下行条数超过上限
+	ErrCodeCustomerServiceOutOfLimit = 45047
+	// ErrCodeInvalidDataFormat 47001 解析 JSON/XML 内容错误
+	ErrCodeInvalidDataFormat = 47001
+	// ErrCodeInvalidArgument 47003 模板参数不准确，可能为空或者不满足规则
+	ErrCodeInvalidArgument = 47003
+	// ErrCodeAPIUnauthorized 48001 api 功能未授权，请确认小程序已获得该接口
+	ErrCodeAPIUnauthorized = 48001
+	// ErrCodeAPIBanned 48004 api 接口被封禁
+	ErrCodeAPIBanned = 48004
+	// ErrCodeClearQuotaLimitReached 48006 清空 API 调用次数的操作已达到每月上限（10 次）
+	ErrCodeClearQuotaLimitReached = 48006
+	// ErrCodeUserUnauthorized 50001 用户未授权该 api
+	ErrCodeUserUnauthorized = 50001
+	// ErrCodeUserLimited 50002 用户受限，可能是违规后接口被封禁
+	ErrCodeUserLimited = 50002
+	// ErrCodeInvalidAuthorizerRefreshToken 61023 authorizer_refresh_token 无效
+	ErrCodeInvalidAuthorizerRefreshToken = 61023
+	// ErrCodeSystemError 61450 系统错误
+	ErrCodeSystemError = 61450
+	// ErrCodeInvalidParameter 61451 参数错误
+	ErrCodeInvalidParameter = 61451
+	// ErrCodeRidNotFound 76001 rid 不存在
+	ErrCodeRidNotFound = 76001
+	// ErrCodeRidMismatch 76002 rid 不正确或不属于当前账号
+	ErrCodeRidMismatch = 76002
+	// ErrCodeCgiPathNotFound 76021 cgi_path 填错了
+	ErrCodeCgiPathNotFound = 76021
+	// ErrCodeCgiPathQuotaUnsupported 76022 当前调用接口使用的 token 与 API 不匹配
+	ErrCodeCgiPathQuotaUnsupported = 76022
+	// ErrCodeInvalidRequestSignature 87009 无效的签名
+	ErrCodeInvalidRequestSignature = 87009
+)
+
+var (
+	ErrorSystemBusy                    = errors.New("system busy")
+	ErrorInvalidCredential             = errors.New("invalid credential")
+	ErrorInvalidGrantType              = errors.New("invalid grant type")
+	ErrorInvalidOpenID                 = errors.New("invalid openid")
+	ErrorInvalidAppID                  = errors.New("invalid appid")
+	ErrorInvalidAccessToken            = errors.New("invalid access token")
+	ErrorInvalidCode                   = errors.New("invalid code")
+	ErrorInvalidRefreshToken           = errors.New("invalid refresh token")
+	ErrorInvalidTemplateID             = errors.New("invalid template id")
+	ErrorInvalidURL                    = errors.New("invalid url")
+	ErrorInvalidRequestURL             = errors.New("invalid request url")
+	ErrorInvalidArgs                   = errors.New("invalid args")
+	ErrorInvalidAppSecret              = errors.New("invalid appsecret")
+	ErrorCodeBeenUsed                  = errors.New("code been used")
+	ErrorIPNotInWhitelist              = errors.New("ip not in whitelist")
+	ErrorHighRiskUser                  = errors.New("high risk user")
+	ErrorAccessTokenMissing            = errors.New("access token missing")
+	ErrorAppIDMissing                  = errors.New("appid missing")
+	ErrorRefreshTokenMissing           = errors.New("refresh token missing")
+	ErrorAppSecretMissing              = errors.New("appsecret missing")
+	ErrorCodeMissing                   = errors.New("code missing")
+	ErrorInvalidPage                   = errors.New("invalid page")
+	ErrorAccessTokenExpired            = errors.New("access token expired")
+	ErrorRefreshTokenExpired           = errors.New("refresh token expired")
+	ErrorCodeExpired                   = errors.New("code expired")
+	ErrorRequireGetMethod              = errors.New("require GET method")
+	ErrorRequirePostMethod             = errors.New("require POST method")
+	ErrorRequireHTTPS                  = errors.New("require https")
+	ErrorRequireSubscribe              = errors.New("require subscribe")
+	ErrorUserRefused                   = errors.New("user refuse to accept the msg")
+	ErrorAppIDOpenIDMismatch           = errors.New("appid and openid not match")
+	ErrorEmptyPostData                 = errors.New("empty post data")
+	ErrorQuotaExceeded                 = errors.New("reach max api daily quota limit")
+	ErrorAPIMinuteQuotaReached         = errors.New("api minute-quota reach limit")
+	ErrorReplyTimeLimit                = errors.New("response out of time limit")
+	ErrorQrCodeCountLimit              = errors.New("qrcode count out of limit")
+	ErrorCustomerServiceOutOfLimit     = errors.New("out of response count limit")
+	ErrorInvalidDataFormat             = errors.New("data format error")
+	ErrorInvalidArgument               = errors.New("argument invalid")
+	ErrorAPIUnauthorized               = errors.New("api unauthorized")
+	ErrorAPIBanned                     = errors.New("api forbidden")
+	ErrorClearQuotaLimitReached        = errors.New("forbid to clear quota because of reaching the limit")
+	ErrorUserUnauthorized              = errors.New("user unauthorized")
+	ErrorUserLimited                   = errors.New("user limited")
+	ErrorInvalidAuthorizerRefreshToken = errors.New("refresh_token is invalid")
+	ErrorSystemError                   = errors.New("system error")
+	ErrorInvalidParameter              = errors.New("invalid parameter")
+	ErrorRidNotFound                   = errors.New("rid not found")
+	ErrorRidMismatch                   = errors.New("rid is error")
+	ErrorCgiPathNotFound               = errors.New("cgi_path not found")
+	ErrorCgiPathQuotaUnsupported       = errors.New("could not query this cgi_path")
+	ErrorInvalidRequestSignature       = errors.New("invalid signature")
+)
+
+var errCodeCatalog = map[int]errCodeInfo{
+	ErrCodeSystemBusy:                    {err: ErrorSystemBusy, description: "系统繁忙，此时请开发者稍候再试", flags: errFlagRetryable},
+	ErrCodeInvalidCredential:             {err: ErrorInvalidCredential, description: "获取 access_token 时 AppSecret 错误，或者 access_token 无效", flags: errFlagToken},
+	ErrCodeInvalidGrantType:              {err: ErrorInvalidGrantType, description: "不合法的凭证类型", flags: 0},
+	ErrCodeInvalidOpenID:                 {err: ErrorInvalidOpenID, description: "不合法的 OpenID，请开发者确认 OpenID 是否已关注公众号，或是否是其他公众号的 OpenID", flags: 0},
+	ErrCodeInvalidAppID:                  {err: ErrorInvalidAppID, description: "不合法的 AppID，请开发者检查 AppID 的正确性，避免异常字符，注意大小写", flags: 0},
+	ErrCodeInvalidAccessToken:            {err: ErrorInvalidAccessToken, description: "不合法的 access_token，请开发者认真比对 access_token 的有效性（如是否过期），或查看是否正在为恰当的公众号调用接口", flags: errFlagToken},
+	ErrCodeInvalidCode:                   {err: ErrorInvalidCode, description: "无效的 oauth_code 或 js_code", flags: 0},
+	ErrCodeInvalidRefreshToken:           {err: ErrorInvalidRefreshToken, description: "不合法的 refresh_token", flags: 0},
+	ErrCodeInvalidTemplateID:             {err: ErrorInvalidTemplateID, description: "不合法的 template_id", flags: 0},
+	ErrCodeInvalidURL:                    {err: ErrorInvalidURL, description: "无效的 url", flags: 0},
+	ErrCodeInvalidRequestURL:             {err: ErrorInvalidRequestURL, description: "不合法的 URL", flags: 0},
+	ErrCodeInvalidArgs:                   {err: ErrorInvalidArgs, description: "参数错误", flags: 0},
+	ErrCodeInvalidAppSecret:              {err: ErrorInvalidAppSecret, description: "不合法的 AppSecret", flags: 0},
+	ErrCodeCodeBeenUsed:                  {err: ErrorCodeBeenUsed, description: "oauth_code 或 js_code 已被使用", flags: 0},
+	ErrCodeIPNotInWhitelist:              {err: ErrorIPNotInWhitelist, description: "调用接口的 IP 地址不在白名单中，请在接口 IP 白名单中进行设置", flags: 0},
+	ErrCodeHighRiskUser:                  {err: ErrorHighRiskUser, description: "高风险等级用户，小程序登录拦截", flags: 0},
+	ErrCodeAccessTokenMissing:            {err: ErrorAccessTokenMissing, description: "缺少 access_token 参数", flags: 0},
+	ErrCodeAppIDMissing:                  {err: ErrorAppIDMissing, description: "缺少 appid 参数", flags: 0},
+	ErrCodeRefreshTokenMissing:           {err: ErrorRefreshTokenMissing, description: "缺少 refresh_token 参数", flags: 0},
+	ErrCodeAppSecretMissing:              {err: ErrorAppSecretMissing, description: "缺少 secret 参数", flags: 0},
+	ErrCodeCodeMissing:                   {err: ErrorCodeMissing, description: "缺少 oauth code", flags: 0},
+	ErrCodeInvalidPage:                   {err: ErrorInvalidPage, description: "page 路径不正确，需要保证在现网版本小程序中存在", flags: 0},
+	ErrCodeAccessTokenExpired:            {err: ErrorAccessTokenExpired, description: "access_token 超时，请检查 access_token 的有效期", flags: errFlagToken},
+	ErrCodeRefreshTokenExpired:           {err: ErrorRefreshTokenExpired, description: "refresh_token 超时", flags: 0},
+	ErrCodeCodeExpired:                   {err: ErrorCodeExpired, description: "oauth_code 超时", flags: 0},
+	ErrCodeRequireGetMethod:              {err: ErrorRequireGetMethod, description: "需要 GET 请求", flags: 0},
+	ErrCodeRequirePostMethod:             {err: ErrorRequirePostMethod, description: "需要 POST 请求", flags: 0},
+	ErrCodeRequireHTTPS:                  {err: ErrorRequireHTTPS, description: "需要 HTTPS 请求", flags: 0},
+	ErrCodeRequireSubscribe:              {err: ErrorRequireSubscribe, description: "需要接收者关注", flags: errFlagRefused},
+	ErrCodeUserRefused:                   {err: ErrorUserRefused, description: "用户拒绝接受消息，如果用户之前曾经订阅过，则表示用户取消了订阅关系", flags: errFlagRefused},
+	ErrCodeAppIDOpenIDMismatch:           {err: ErrorAppIDOpenIDMismatch, description: "appid 与 openid 不匹配", flags: 0},
+	ErrCodeEmptyPostData:                 {err: ErrorEmptyPostData, description: "POST 的数据包为空", flags: 0},
+	ErrCodeQuotaExceeded:                 {err: ErrorQuotaExceeded, description: "接口调用超过限制", flags: errFlagQuota},
+	ErrCodeAPIMinuteQuotaReached:         {err: ErrorAPIMinuteQuotaReached, description: "API 调用太频繁，请稍候再试", flags: errFlagQuota | errFlagRetryable},
+	ErrCodeReplyTimeLimit:                {err: ErrorReplyTimeLimit, description: "回复时间超过限制", flags: 0},
+	ErrCodeQrCodeCountLimit:              {err: ErrorQrCodeCountLimit, description: "生成码个数总和到达最大个数限制", flags: errFlagQuota},
+	ErrCodeCustomerServiceOutOfLimit:     {err: ErrorCustomerServiceOutOfLimit, description: "客服接口下行条数超过上限", flags: errFlagQuota},
+	ErrCodeInvalidDataFormat:             {err: ErrorInvalidDataFormat, description: "解析 JSON/XML 内容错误", flags: 0},
+	ErrCodeInvalidArgument:               {err: ErrorInvalidArgument, description: "模板参数不准确，可能为空或者不满足规则", flags: 0},
+	ErrCodeAPIUnauthorized:               {err: ErrorAPIUnauthorized, description: "api 功能未授权，请确认小程序已获得该接口", flags: 0},
+	ErrCodeAPIBanned:                     {err: ErrorAPIBanned, description: "api 接口被封禁", flags: 0},
+	ErrCodeClearQuotaLimitReached:        {err: ErrorClearQuotaLimitReached, description: "清空 API 调用次数的操作已达到每月上限（10 次）", flags: errFlagQuota},
+	ErrCodeUserUnauthorized:              {err: ErrorUserUnauthorized, description: "用户未授权该 api", flags: 0},
+	ErrCodeUserLimited:                   {err: ErrorUserLimited, description: "用户受限，可能是违规后接口被封禁", flags: 0},
+	ErrCodeInvalidAuthorizerRefreshToken: {err: ErrorInvalidAuthorizerRefreshToken, description: "authorizer_refresh_token 无效", flags: 0},
+	ErrCodeSystemError:                   {err: ErrorSystemError, description: "系统错误", flags: errFlagRetryable},
+	ErrCodeInvalidParameter:              {err: ErrorInvalidParameter, description: "参数错误", flags: 0},
+	ErrCodeRidNotFound:                   {err: ErrorRidNotFound, description: "rid 不存在", flags: 0},
+	ErrCodeRidMismatch:                   {err: ErrorRidMismatch, description: "rid 不正确或不属于当前账号", flags: 0},
+	ErrCodeCgiPathNotFound:               {err: ErrorCgiPathNotFound, description: "cgi_path 填错了", flags: 0},
+	ErrCodeCgiPathQuotaUnsupported:       {err: ErrorCgiPathQuotaUnsupported, description: "当前调用接口使用的 token 与 API 不匹配", flags: 0},
+	ErrCodeInvalidRequestSignature:       {err: ErrorInvalidRequestSignature, description: "无效的签名", flags: 0},
+}
@@ -0,0 +1,179 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"resty.dev/v3"
+)
+
+var ErrorNoRid = errors.New("error carries no rid")
+
+type errCodeFlags uint8
+
+const (
+	errFlagRetryable errCodeFlags = 1 << iota // transient, the same request may succeed later
+	errFlagQuota                              // a call quota or frequency limit was hit
+	errFlagRefused                            // the user refused to receive messages
+	errFlagToken                              // the access token is invalid and must be refreshed
+)
+
+type errCodeInfo struct {
+	err         error
+	description string
+	flags       errCodeFlags
+}
+
+var ridPattern = regexp.MustCompile(`rid: ?([0-9a-zA-Z-]+)`)
+
+// parseRid extracts the request ID that WeChat appends to errmsg as "rid: xxx".
+func parseRid(errMsg string) string {
+	m := ridPattern.FindStringSubmatch(errMsg)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// withResponse records the endpoint path, HTTP status, latency and headers of resp on
+// API errors, and the rid from the response body if errmsg did not carry one.
+func withResponse(err error, resp *resty.Response) error {
+	e, ok := err.(ErrResponse)
+	if !ok {
+		return err
+	}
+	e.Endpoint = endpointOf(resp)
+	e.Response = &ResponseInfo{
+		HTTPStatus: resp.StatusCode(),
+		Latency:    resp.Duration(),
+		Header:     resp.Header().Clone(),
+	}
+	if e.Rid == "" {
+		var body struct {
+			Rid string `json:"rid"`
+		}
+		if json.Unmarshal(resp.Bytes(), &body) == nil {
+			e.Rid = body.Rid
+		}
+	}
+	return e
+}
+
+// endpointOf returns the request path of resp. The full URL carries the access_token.
+func endpointOf(resp *resty.Response) string {
+	if resp.Request == nil || resp.Request.RawRequest == nil {
+		return ""
+	}
+	return resp.Request.RawRequest.URL.Path
+}
+
+// HTTPError is returned when WeChat answers with a non-2xx HTTP status and no errcode.
+type HTTPError struct {
+	StatusCode int           // HTTP 状态码
+	Status     string        // HTTP 状态行
+	Endpoint   string        // 请求路径，不含 access_token
+	Latency    time.Duration // 请求耗时
+	Header     http.Header   // 响应头
+}
+
+func newHTTPError(resp *resty.Response) error {
+	return HTTPError{
+		StatusCode: resp.StatusCode(),
+		Status:     resp.Status(),
+		Endpoint:   endpointOf(resp),
+		Latency:    resp.Duration(),
+		Header:     resp.Header().Clone(),
+	}
+}
+
+func (e HTTPError) Error() string {
+	if e.Endpoint == "" {
+		return fmt.Sprintf("wechat: http status %s", e.Status)
+	}
+	return fmt.Sprintf("wechat %s: http status %s", e.Endpoint, e.Status)
+}
+
+// RidOf returns the WeChat request ID carried by err, or "" if there is none.
+func RidOf(err error) string {
+	var e ErrResponse
+	if errors.As(err, &e) {
+		return e.Rid
+	}
+	return ""
+}
+
+// DiagnoseError looks up the request and response behind a failed call through
+// /cgi-bin/openapi/rid/get, using the rid carried by err.
+func (w *Wechat) DiagnoseError(ctx context.Context, err error, options ...RequestOption) (*RidInfoResponse, error) {
+	rid := RidOf(err)
+	if rid == "" {
+		return nil, fmt.Errorf("%w: %v", ErrorNoRid, err)
+	}
+	return w.GetRidInfo(ctx, rid, options...)
+}
+
+// ErrCodeDescription returns the documented description of a WeChat errcode, or "" if it is not in the catalog.
+func ErrCodeDescription(errCode int) string {
+	return errCodeCatalog[errCode].description
+}
+
+// ErrCodeOf returns the WeChat errcode carried by err, or 0 if err is not an API error.
+func ErrCodeOf(err error) int {
+	var e ErrResponse
+	if errors.As(err, &e) {
+		return e.ErrCode
+	}
+	for code, info := range errCodeCatalog {
+		if errors.Is(err, info.err) {
+			return code
+		}
+	}
+	return 0
+}
+
+// IsRetryable reports whether err is transient, such as errcode -1 (system busy), an HTTP 5xx
+// or 429 response or a network failure, so that repeating the same request may succeed.
+func IsRetryable(err error) bool {
+	if hasErrCodeFlag(err, errFlagRetryable) {
+		return true
+	}
+	var httpErr HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= http.StatusInternalServerError || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// IsQuotaExceeded reports whether err means a call quota or frequency limit was reached, such as errcode 45009.
+func IsQuotaExceeded(err error) bool {
+	return hasErrCodeFlag(err, errFlagQuota)
+}
+
+// IsUserRefused reports whether err means the user refused or cancelled a subscription, such as errcode 43101.
+func IsUserRefused(err error) bool {
+	return hasErrCodeFlag(err, errFlagRefused)
+}
+
+// IsAccessTokenError reports whether err means the access token was rejected and must be refreshed.
+func IsAccessTokenError(err error) bool {
+	return hasErrCodeFlag(err, errFlagToken)
+}
+
+func hasErrCodeFlag(err error, flag errCodeFlags) bool {
+	if err == nil {
+		return false
+	}
+	info, ok := errCodeCatalog[ErrCodeOf(err)]
+	return ok && info.flags&flag != 0
+}
@@ -0,0 +1,108 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+)
+
+func TestErrResponse_Classification(t *testing.T) {
+	tests := []struct {
+		code      int
+		sentinel  error
+		retryable bool
+		quota     bool
+		refused   bool
+	}{
+		{code: -1, sentinel: ErrorSystemBusy, retryable: true},
+		{code: 40001, sentinel: ErrorInvalidCredential},
+		{code: 40029, sentinel: ErrorInvalidCode},
+		{code: 43101, sentinel: ErrorUserRefused, refused: true},
+		{code: 45009, sentinel: ErrorQuotaExceeded, quota: true},
+		{code: 45011, sentinel: ErrorAPIMinuteQuotaReached, retryable: true, quota: true},
+		{code: 47003, sentinel: ErrorInvalidArgument},
+		{code: 61023, sentinel: ErrorInvalidAuthorizerRefreshToken},
+	}
+	for _, tt := range tests {
+		err := checkResponseError(tt.code, "message")
+		if !errors.Is(err, tt.sentinel) {
+			t.Errorf("errcode %d: expected errors.Is to match %v", tt.code, tt.sentinel)
+		}
+		if !errors.Is(err, ErrResponse{ErrCode: tt.code}) {
+			t.Errorf("errcode %d: expected errors.Is to match an ErrResponse with the same code", tt.code)
+		}
+		if IsRetryable(err) != tt.retryable || IsQuotaExceeded(err) != tt.quota || IsUserRefused(err) != tt.refused {
+			t.Errorf("errcode %d: unexpected classification retryable=%v quota=%v refused=%v", tt.code, IsRetryable(err), IsQuotaExceeded(err), IsUserRefused(err))
+		}
+		if ErrCodeDescription(tt.code) == "" {
+			t.Errorf("errcode %d: missing description", tt.code)
+		}
+	}
+	if ErrCodeOf(ErrorQuotaExceeded) != ErrCodeQuotaExceeded {
+		t.Error("expected ErrCodeOf to resolve sentinel errors")
+	}
+	if IsRetryable(errors.New("boom")) || IsRetryable(nil) {
+		t.Error("expected plain errors not to be retryable")
+	}
+}
+
+func TestErrResponse_KeepsRidAndEndpoint(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	srv.FailNext("/cgi-bin/message/subscribe/send", ErrCodeUserRefused, "user refuse to accept the msg rid: 64f1e6c6-1b2a3c4d-5e6f7a8b")
+	err := wx.SendMessage(context.Background(), &SubscribeMessageRequest{TemplateID: "tpl", ToUser: "openid"})
+	if !IsUserRefused(err) {
+		t.Fatalf("expected user refused error, got %v", err)
+	}
+	var errResp ErrResponse
+	if !errors.As(err, &errResp) {
+		t.Fatalf("expected ErrResponse, got %T", err)
+	}
+	if errResp.Rid != "64f1e6c6-1b2a3c4d-5e6f7a8b" {
+		t.Errorf("unexpected rid %q", errResp.Rid)
+	}
+	if errResp.Endpoint != "/cgi-bin/message/subscribe/send" {
+		t.Errorf("unexpected endpoint %q", errResp.Endpoint)
+	}
+	if info := errResp.Response; info == nil || info.HTTPStatus != http.StatusOK || info.Latency <= 0 || !strings.Contains(info.Header.Get("Content-Type"), "json") {
+		t.Errorf("unexpected response metadata %+v", info)
+	}
+	if err == error(ErrResponse{}) || err == ErrorUserRefused {
+		t.Error("expected == not to match, and not to panic")
+	}
+	if want := "wechat /cgi-bin/message/subscribe/send: errcode 43101: user refuse to accept the msg rid: 64f1e6c6-1b2a3c4d-5e6f7a8b"; err.Error() != want {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+func TestErrResponse_RidFromBody(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	srv.HandleWithAccessToken("/wxa/business/getuserphonenumber", func(rw http.ResponseWriter, r *http.Request) {
+		wechattest.WriteJSON(rw, http.StatusOK, map[string]any{"errcode": ErrCodeInvalidCode, "errmsg": "invalid code", "rid": "65a0b1c2-3d4e5f60-718293a4"})
+	})
+	_, err := wx.GetUserPhoneNumber(context.Background(), "code")
+	if RidOf(err) != "65a0b1c2-3d4e5f60-718293a4" {
+		t.Errorf("unexpected rid %q from %v", RidOf(err), err)
+	}
+}
+
+func TestWechat_DiagnoseError(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	ctx := context.Background()
+	srv.FailNext("/cgi-bin/message/subscribe/send", ErrCodeInvalidTemplateID, "invalid template_id rid: 6523d1a2-00000000-1a2b3c4d")
+	sendErr := wx.SendMessage(ctx, &SubscribeMessageRequest{TemplateID: "missing", ToUser: "openid"})
+	info, err := wx.DiagnoseError(ctx, sendErr)
+	if err != nil {
+		t.Fatalf("DiagnoseError returned error: %v", err)
+	}
+	if !strings.Contains(info.Request.RequestBody, `"template_id":"missing"`) {
+		t.Errorf("unexpected request body %q", info.Request.RequestBody)
+	}
+	_, err = wx.DiagnoseError(ctx, errors.New("boom"))
+	if !errors.Is(err, ErrorNoRid) {
+		t.Errorf("expected ErrorNoRid, got %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Backup API hosts published by WeChat. Requests to them are served the same way as to DefaultBaseURL.
+const (
+	BackupBaseURL   = "https://api2.weixin.qq.com"
+	ShanghaiBaseURL = "https://sh.api.weixin.qq.com"
+	ShenzhenBaseURL = "https://sz.api.weixin.qq.com"
+	HongKongBaseURL = "https://hk.api.weixin.qq.com"
+)
+
+// DefaultFailoverBaseURLs lists DefaultBaseURL followed by the backup hosts, for use with WithBaseURLs.
+var DefaultFailoverBaseURLs = []string{DefaultBaseURL, BackupBaseURL, ShanghaiBaseURL, ShenzhenBaseURL, HongKongBaseURL}
+
+// DefaultFailoverCooldown is how long a host is skipped after it failed.
+const DefaultFailoverCooldown = 30 * time.Second
+
+// WithBaseURLs sets an ordered list of API hosts, such as DefaultFailoverBaseURLs. Requests go
+// to the first healthy host and move on to the next one on network errors and HTTP 5xx
+// responses. A host that failed is skipped for the failover cooldown, after which requests
+// return to it, so traffic recovers to the primary host on its own. Invalid URLs are ignored.
+// Calls that are not idempotent, such as SendMessage or PostJSON, only move on to the next
+// host when they could not reach the previous one, as a timeout or a 5xx response does not
+// tell whether WeChat acted on them.
+func WithBaseURLs(baseURLs ...string) Option {
+	return func(opts *options) {
+		if len(baseURLs) > 0 {
+			opts.baseURL = baseURLs[0]
+			opts.baseURLs = baseURLs
+		}
+	}
+}
+
+// WithFailoverCooldown sets how long a failing host is skipped, DefaultFailoverCooldown by default.
+func WithFailoverCooldown(cooldown time.Duration) Option {
+	return func(opts *options) {
+		opts.failoverCooldown = cooldown
+	}
+}
+
+type noReplayKey struct{}
+
+// withNoReplay marks the requests made with ctx as non-idempotent: they are only sent to
+// the next host when they could not reach the previous one at all.
+func withNoReplay(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noReplayKey{}, true)
+}
+
+func noReplay(ctx context.Context) bool {
+	v, _ := ctx.Value(noReplayKey{}).(bool)
+	return v
+}
+
+// notSent reports whether err happened before the request could reach the host,
+// while resolving, dialing or during the TLS handshake.
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	switch {
+	case errors.As(err, &dnsErr), errors.As(err, &recordErr), errors.As(err, &certErr):
+		return true
+	case errors.As(err, &opErr):
+		return opErr.Op == "dial"
+	default:
+		return false
+	}
+}
+
+// DomainStatus is the passive health of an API host configured with WithBaseURLs.
+type DomainStatus struct {
+	BaseURL   string    // 接口域名
+	Healthy   bool      // 是否可用
+	Failures  int       // 连续失败次数
+	LastError string    // 最近一次失败原因
+	DownUntil time.Time // 不可用状态的截止时间
+}
+
+type domainState struct {
+	baseURL   string
+	url       *url.URL
+	failures  int
+	lastError string
+	downUntil time.Time
+}
+
+// failoverTransport sends each request to the first healthy host and fails over to the
+// others. It rewrites requests addressed to the primary host only.
+type failoverTransport struct {
+	next     http.RoundTripper
+	cooldown time.Duration
+	mu       sync.Mutex
+	domains  []*domainState
+}
+
+// newFailoverTransport returns nil unless baseURLs has at least two valid URLs.
+func newFailoverTransport(next http.RoundTripper, baseURLs []string, cooldown time.Duration) *failoverTransport {
+	t := &failoverTransport{next: next, cooldown: cooldown}
+	for _, baseURL := range baseURLs {
+		u, err := url.Parse(baseURL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		t.domains = append(t.domains, &domainState{baseURL: baseURL, url: u})
+	}
+	if len(t.domains) < 2 {
+		return nil
+	}
+	return t
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	primary := t.domains[0].url
+	if req.URL.Host != primary.Host {
+		return t.next.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	replay := !noReplay(req.Context())
+	domains := t.order(time.Now())
+	var resp *http.Response
+	var err error
+	for i, d := range domains {
+		r := req.Clone(req.Context())
+		r.URL.Scheme, r.URL.Host, r.Host = d.url.Scheme, d.url.Host, ""
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err = t.next.RoundTrip(r)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			t.markSuccess(d)
+			return resp, nil
+		}
+		if err != nil {
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			t.markFailure(d, err.Error())
+			if !replay && !notSent(err) {
+				return nil, err // the host may have acted on the request
+			}
+		} else {
+			t.markFailure(d, resp.Status)
+			if !replay {
+				return resp, nil
+			}
+			if i < len(domains)-1 {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}
+		}
+	}
+	return resp, err
+}
+
+// order returns the healthy hosts in configured order, followed by the unhealthy ones
+// in the order they become available again.
+func (t *failoverTransport) order(now time.Time) []*domainState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var healthy, unhealthy []*domainState
+	for _, d := range t.domains {
+		if now.Before(d.downUntil) {
+			unhealthy = append(unhealthy, d)
+		} else {
+			healthy = append(healthy, d)
+		}
+	}
+	slices.SortStableFunc(unhealthy, func(a, b *domainState) int {
+		return a.downUntil.Compare(b.downUntil)
+	})
+	return append(healthy, unhealthy...)
+}
+
+func (t *failoverTransport) markFailure(d *domainState, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d.failures++
+	d.lastError = reason
+	d.downUntil = time.Now().Add(t.cooldown)
+}
+
+func (t *failoverTransport) markSuccess(d *domainState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d.failures = 0
+	d.downUntil = time.Time{}
+}
+
+func (t *failoverTransport) status() []DomainStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	statuses := make([]DomainStatus, 0, len(t.domains))
+	for _, d := range t.domains {
+		statuses = append(statuses, DomainStatus{
+			BaseURL:   d.baseURL,
+			Healthy:   !now.Before(d.downUntil),
+			Failures:  d.failures,
+			LastError: d.lastError,
+			DownUntil: d.downUntil,
+		})
+	}
+	return statuses
+}
+
+// DomainStatus returns the health of the hosts configured with WithBaseURLs, or nil without failover.
+func (w *Wechat) DomainStatus() []DomainStatus {
+	if w.failover == nil {
+		return nil
+	}
+	return w.failover.status()
+}
+
+// GetAPIDomainIP returns the egress IP addresses of the WeChat API servers, for firewall allowlists.
+func (w *Wechat) GetAPIDomainIP(ctx context.Context, options ...RequestOption) (*APIDomainIPResponse, error) {
+	return withAccessToken(ctx, w, func(ctx context.Context, accessToken string) (*APIDomainIPResponse, error) {
+		resp, err := w.client.R().
+			Clone(ctx).
+			SetQueryParams(map[string]string{
+				"access_token": accessToken,
+			}).
+			Get("/cgi-bin/get_api_domain_ip")
+		if err != nil {
+			return nil, err
+		}
+		return loadSuccessResponse(resp, func(a *APIDomainIPResponse) error {
+			return checkResponseError(a.ErrCode, a.ErrMsg)
+		})
+	}, options...)
+}
+
+// CheckCallback asks WeChat to resolve and ping the callback URL of the app through the
+// given operator, to diagnose why pushed messages do not arrive.
+func (w *Wechat) CheckCallback(ctx context.Context, req *CallbackCheckRequest, options ...RequestOption) (*CallbackCheckResponse, error) {
+	return withAccessToken(ctx, w, func(ctx context.Context, accessToken string) (*CallbackCheckResponse, error) {
+		resp, err := w.client.R().
+			Clone(ctx).
+			SetQueryParams(map[string]string{
+				"access_token": accessToken,
+			}).
+			SetBody(req).
+			Post("/cgi-bin/callback/check")
+		if err != nil {
+			return nil, err
+		}
+		return loadSuccessResponse(resp, func(a *CallbackCheckResponse) error {
+			return checkResponseError(a.ErrCode, a.ErrMsg)
+		})
+	}, options...)
+}
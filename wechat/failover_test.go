@@ -0,0 +1,180 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+)
+
+// newFlakyProxy returns a server that forwards to srv, or answers 502 while down is set.
+func newFlakyProxy(t *testing.T, srv *wechattest.Server, down *atomic.Bool, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	target, _ := url.Parse(srv.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	primary := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if down.Load() {
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		proxy.ServeHTTP(rw, r)
+	}))
+	t.Cleanup(primary.Close)
+	return primary
+}
+
+func TestWechat_Failover(t *testing.T) {
+	srv := wechattest.NewServer()
+	t.Cleanup(srv.Close)
+	var down atomic.Bool
+	var hits atomic.Int32
+	primary := newFlakyProxy(t, srv, &down, &hits)
+	config := Config{AppID: srv.AppID, AppSecret: srv.AppSecret}
+	wx := NewWechat(config, NewMemoryCache(0), WithBaseURLs(primary.URL, srv.URL), WithFailoverCooldown(100*time.Millisecond))
+	ctx := context.Background()
+
+	down.Store(true)
+	_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if err != nil {
+		t.Fatalf("expected failover to the backup host, got %v", err)
+	}
+	status := wx.DomainStatus()
+	if len(status) != 2 || status[0].Healthy || status[0].Failures != 1 || !status[1].Healthy {
+		t.Fatalf("unexpected domain status %+v", status)
+	}
+	// the primary is skipped during the cooldown
+	before := hits.Load()
+	_, err = wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if err != nil || hits.Load() != before {
+		t.Fatalf("expected the unhealthy primary to be skipped, err=%v hits=%d", err, hits.Load()-before)
+	}
+
+	down.Store(false)
+	time.Sleep(150 * time.Millisecond)
+	before = hits.Load()
+	_, err = wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if err != nil || hits.Load() != before+1 {
+		t.Fatalf("expected traffic to recover to the primary, err=%v hits=%d", err, hits.Load()-before)
+	}
+	if status := wx.DomainStatus(); !status[0].Healthy || status[0].Failures != 0 {
+		t.Errorf("expected the primary to be healthy again, got %+v", status[0])
+	}
+}
+
+func TestWechat_Failover_NetworkError(t *testing.T) {
+	srv := wechattest.NewServer()
+	t.Cleanup(srv.Close)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	config := Config{AppID: srv.AppID, AppSecret: srv.AppSecret}
+	wx := NewWechat(config, &nopCache{}, WithBaseURLs(closed.URL, srv.URL))
+	err := wx.SendMessage(context.Background(), &SubscribeMessageRequest{TemplateID: "tpl", ToUser: "openid"})
+	if err != nil {
+		t.Fatalf("expected failover to the backup host, got %v", err)
+	}
+	calls := srv.Calls("/cgi-bin/message/subscribe/send")
+	if len(calls) != 1 || len(calls[0].Body) == 0 {
+		t.Fatalf("expected the request that never reached the primary to be sent to the backup host, got %+v", calls)
+	}
+	if status := wx.DomainStatus(); status[0].LastError == "" {
+		t.Errorf("expected the network error to be recorded, got %+v", status[0])
+	}
+}
+
+func TestWechat_Failover_NonIdempotent(t *testing.T) {
+	tests := []struct {
+		name     string
+		stable   bool
+		endpoint string
+		call     func(ctx context.Context, wx *Wechat) error
+	}{
+		{
+			name:     "message",
+			endpoint: "/cgi-bin/message/subscribe/send",
+			call: func(ctx context.Context, wx *Wechat) error {
+				return wx.SendMessage(ctx, &SubscribeMessageRequest{TemplateID: "tpl", ToUser: "openid"})
+			},
+		},
+		{
+			name:     "js code",
+			endpoint: "/sns/jscode2session",
+			call: func(ctx context.Context, wx *Wechat) error {
+				_, err := wx.JsCode2Session(ctx, "code1")
+				return err
+			},
+		},
+		{
+			name:     "oauth code",
+			endpoint: "/sns/oauth2/access_token",
+			call: func(ctx context.Context, wx *Wechat) error {
+				_, err := wx.SnsOauth2(ctx, "code1")
+				return err
+			},
+		},
+		{
+			name:     "forced stable token",
+			stable:   true,
+			endpoint: "/cgi-bin/stable_token",
+			call: func(ctx context.Context, wx *Wechat) error {
+				_, err := wx.ForceRefreshAccessToken(ctx)
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := wechattest.NewServer()
+			t.Cleanup(srv.Close)
+			var down atomic.Bool
+			var hits atomic.Int32
+			primary := newFlakyProxy(t, srv, &down, &hits)
+			config := Config{AppID: srv.AppID, AppSecret: srv.AppSecret, StableToken: tt.stable}
+			wx := NewWechat(config, NewMemoryCache(0), WithBaseURLs(primary.URL, srv.URL))
+			ctx := context.Background()
+			_, err := wx.GetAccessToken(ctx, false)
+			if err != nil {
+				t.Fatalf("failed to get access token: %v", err)
+			}
+
+			down.Store(true)
+			before, sent := hits.Load(), len(srv.Calls(tt.endpoint))
+			err = tt.call(ctx, wx)
+			var httpErr HTTPError
+			if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+				t.Fatalf("expected the 502 of the primary, got %v", err)
+			}
+			if n := len(srv.Calls(tt.endpoint)) - sent; hits.Load() != before+1 || n != 0 {
+				t.Errorf("expected the call not to be replayed on the backup host, got %d calls", n)
+			}
+			// idempotent calls still fail over
+			_, err = wx.GetAPIDomainIP(ctx)
+			if err != nil {
+				t.Errorf("expected GetAPIDomainIP to fail over, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWechat_NetworkDiagnostics(t *testing.T) {
+	wx, _ := newTestWechat(t, &nopCache{})
+	ctx := context.Background()
+	ips, err := wx.GetAPIDomainIP(ctx)
+	if err != nil || len(ips.IPList) == 0 {
+		t.Fatalf("GetAPIDomainIP = %+v, %v", ips, err)
+	}
+	check, err := wx.CheckCallback(ctx, &CallbackCheckRequest{Action: CallbackCheckActionAll, CheckOperator: CallbackCheckOperatorUnicom})
+	if err != nil {
+		t.Fatalf("CheckCallback returned error: %v", err)
+	}
+	if len(check.DNS) != 1 || check.DNS[0].RealOperator != CallbackCheckOperatorUnicom || len(check.Ping) != 1 || check.Ping[0].PackageLoss != "0%" {
+		t.Errorf("unexpected check result %+v", check)
+	}
+}
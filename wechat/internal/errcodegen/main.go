@@ -0,0 +1,120 @@
+// Command errcodegen generates the WeChat errcode catalog of the wechat package from a CSV
+// file with the columns code, name, message, flags and description.
+//
+// For every row it emits an ErrCode<name> constant, an Error<name> sentinel error and a
+// catalog entry carrying the description and the classification flags, which are
+// '|'-separated values out of retryable, quota, refused and token.
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var flagNames = map[string]string{
+	"retryable": "errFlagRetryable",
+	"quota":     "errFlagQuota",
+	"refused":   "errFlagRefused",
+	"token":     "errFlagToken",
+}
+
+type entry struct {
+	code        int
+	name        string
+	message     string
+	flags       []string
+	description string
+}
+
+func main() {
+	in := flag.String("in", "errcodes.csv", "input CSV file")
+	out := flag.String("out", "errcodes_gen.go", "output Go file")
+	pkg := flag.String("pkg", "wechat", "package name")
+	flag.Parse()
+
+	entries, err := readEntries(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := generate(*pkg, *in, entries)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(*out, src, 0o644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readEntries(path string) ([]entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: empty file", path)
+	}
+	seen := make(map[int]bool)
+	var entries []entry
+	for i, record := range records[1:] {
+		if len(record) != 5 {
+			return nil, fmt.Errorf("%s:%d: expected 5 columns, got %d", path, i+2, len(record))
+		}
+		code, err := strconv.Atoi(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+2, err)
+		}
+		if seen[code] {
+			return nil, fmt.Errorf("%s:%d: duplicate code %d", path, i+2, code)
+		}
+		seen[code] = true
+		e := entry{code: code, name: record[1], message: record[2], description: record[4]}
+		if record[3] != "" {
+			for _, f := range strings.Split(record[3], "|") {
+				name, ok := flagNames[f]
+				if !ok {
+					return nil, fmt.Errorf("%s:%d: unknown flag %q", path, i+2, f)
+				}
+				e.flags = append(e.flags, name)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func generate(pkg, source string, entries []entry) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by errcodegen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\nimport \"errors\"\n\n", pkg)
+	b.WriteString("const (\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\t// ErrCode%s %d %s\n\tErrCode%s = %d\n", e.name, e.code, e.description, e.name, e.code)
+	}
+	b.WriteString(")\n\nvar (\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\tError%s = errors.New(%q)\n", e.name, e.message)
+	}
+	b.WriteString(")\n\nvar errCodeCatalog = map[int]errCodeInfo{\n")
+	for _, e := range entries {
+		flags := "0"
+		if len(e.flags) > 0 {
+			flags = strings.Join(e.flags, " | ")
+		}
+		fmt.Fprintf(&b, "\tErrCode%s: {err: Error%s, description: %q, flags: %s},\n", e.name, e.name, e.description, flags)
+	}
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
@@ -2,59 +2,164 @@ package wechat
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha1"
+	"encoding/json"
 	"fmt"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func (w *Wechat) SnsOauth2(ctx context.Context, code string) (*SnsOauth2Response, error) {
-	resp, err := w.client.R().
-		Clone(ctx).
-		SetHeader("Accept", "application/json").
-		SetQueryParams(map[string]string{
-			"appid":      w.config.AppID,
-			"secret":     w.config.AppSecret,
-			"code":       code,
-			"grant_type": "authorization_code",
-		}).
-		Get("/sns/oauth2/access_token")
-	if err != nil {
-		return nil, err
+type jsSDKConfigOptions struct {
+	debug       bool
+	jsAPIList   []string
+	openTagList []string
+}
+
+func newJsSDKConfigOptions(opts ...JsSDKConfigOption) *jsSDKConfigOptions {
+	defaults := &jsSDKConfigOptions{
+		debug:       false,
+		jsAPIList:   []string{},
+		openTagList: nil,
+	}
+	for _, opt := range opts {
+		opt(defaults)
+	}
+	return defaults
+}
+
+type JsSDKConfigOption = func(*jsSDKConfigOptions)
+
+// WithJsAPIList sets the JS interfaces the page uses, such as "updateAppMessageShareData".
+func WithJsAPIList(apis ...string) JsSDKConfigOption {
+	return func(opts *jsSDKConfigOptions) {
+		opts.jsAPIList = append(opts.jsAPIList, apis...)
+	}
+}
+
+// WithOpenTagList sets the open tags the page uses, such as "wx-open-launch-weapp".
+func WithOpenTagList(tags ...string) JsSDKConfigOption {
+	return func(opts *jsSDKConfigOptions) {
+		opts.openTagList = append(opts.openTagList, tags...)
+	}
+}
+
+// WithJsSDKDebug turns on the debug mode of wx.config, which alerts the result of every call.
+func WithJsSDKDebug(debug bool) JsSDKConfigOption {
+	return func(opts *jsSDKConfigOptions) {
+		opts.debug = debug
 	}
-	return loadSuccessResponse(resp, func(a *SnsOauth2Response) error {
-		return nil
-	})
 }
 
-func (w *Wechat) GetJsSDKConfig(ctx context.Context, url string) (*JsSDKConfigResponse, error) {
+// GetJsSDKConfig signs the page at url with the jsapi ticket. The returned config
+// marshals to the object expected by wx.config. The fragment of url is removed
+// before signing, as the JS-SDK requires.
+func (w *Wechat) GetJsSDKConfig(ctx context.Context, url string, options ...JsSDKConfigOption) (*JsSDKConfigResponse, error) {
+	opts := newJsSDKConfigOptions(options...)
 	ticket, err := w.GetJsTicket(ctx, false)
 	if err != nil {
 		return nil, err
 	}
-	timestamp := fmt.Sprintf("%d", time.Now().Unix())
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
 	nonce := randomBase62(16)
-	params := map[string]string{
-		"noncestr":     nonce,
+	return &JsSDKConfigResponse{
+		Debug:       opts.debug,
+		AppId:       w.config.AppID,
+		Timestamp:   timestamp,
+		NonceStr:    nonce,
+		Signature:   JsSDKSignature(ticket, nonce, timestamp, url),
+		JsApiList:   opts.jsAPIList,
+		OpenTagList: opts.openTagList,
+	}, nil
+}
+
+// JsSDKSignature returns the wx.config signature of the page at url, for callers that
+// manage the jsapi ticket themselves. The fragment of url is removed before signing.
+func JsSDKSignature(ticket, nonceStr, timestamp, url string) string {
+	url, _, _ = strings.Cut(url, "#")
+	return generateSignature(map[string]string{
+		"noncestr":     nonceStr,
 		"jsapi_ticket": ticket,
 		"timestamp":    timestamp,
 		"url":          url,
+	})
+}
+
+// CardSignature returns the signature of the card interfaces of the JS-SDK: unlike the
+// jsapi signature, the values themselves are sorted and concatenated before hashing.
+func CardSignature(values ...string) string {
+	sorted := slices.Clone(values)
+	sort.Strings(sorted)
+	hash := sha1.New()
+	hash.Write([]byte(strings.Join(sorted, "")))
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// GetCardExt signs the cardExt of one card for wx.addCard. The returned item can be
+// put in the cardList passed to wx.addCard as is.
+func (w *Wechat) GetCardExt(ctx context.Context, cardID string, req *CardExtRequest) (*AddCardItem, error) {
+	ticket, err := w.GetCardTicket(ctx, false)
+	if err != nil {
+		return nil, err
 	}
-	signature := generateSignature(params)
-	return &JsSDKConfigResponse{
-		AppId:     w.config.AppID,
-		Timestamp: timestamp,
-		NonceStr:  nonce,
-		Signature: signature,
-	}, nil
+	if req == nil {
+		req = &CardExtRequest{}
+	}
+	ext := CardExt{
+		Code:                req.Code,
+		OpenID:              req.OpenID,
+		Timestamp:           strconv.FormatInt(time.Now().Unix(), 10),
+		NonceStr:            randomBase62(16),
+		FixedBeginTimestamp: req.FixedBeginTimestamp,
+		OuterStr:            req.OuterStr,
+	}
+	ext.Signature = CardSignature(ticket, ext.Timestamp, cardID, ext.Code, ext.OpenID, ext.NonceStr)
+	raw, err := json.Marshal(ext)
+	if err != nil {
+		return nil, err
+	}
+	return &AddCardItem{CardId: cardID, CardExt: string(raw)}, nil
+}
+
+// GetChooseCardConfig signs the parameters of wx.chooseCard. The returned config
+// marshals to the object expected by wx.chooseCard.
+func (w *Wechat) GetChooseCardConfig(ctx context.Context, req *ChooseCardRequest) (*ChooseCardConfig, error) {
+	ticket, err := w.GetCardTicket(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		req = &ChooseCardRequest{}
+	}
+	config := &ChooseCardConfig{
+		ShopId:    req.ShopID,
+		CardType:  req.CardType,
+		CardId:    req.CardID,
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		NonceStr:  randomBase62(16),
+		SignType:  "SHA1",
+	}
+	config.CardSign = CardSignature(ticket, w.config.AppID, config.ShopId, config.Timestamp, config.NonceStr, config.CardId, config.CardType)
+	return config, nil
 }
 
+// randomBase62 returns n random characters from crypto/rand, for nonces.
 func randomBase62(n int) string {
-	letters := []rune("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz")
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = letters[time.Now().UnixNano()%int64(len(letters))]
+	const letters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// bytes at or above the largest multiple of len(letters) are dropped to keep the distribution uniform
+	const limit = 256 - 256%len(letters)
+	b := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(b) < n {
+		_, _ = rand.Read(buf)
+		for _, c := range buf {
+			if int(c) < limit && len(b) < n {
+				b = append(b, letters[int(c)%len(letters)])
+			}
+		}
 	}
 	return string(b)
 }
@@ -0,0 +1,118 @@
+package wechat
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJsSDKSignature(t *testing.T) {
+	// example from the JS-SDK documentation
+	ticket := "sM4AOVdWfPE4DxkXGEs8VMCPGGVi4C3VM0P37wVUCFvkVAy_90u5h9nbSlYy3-Sl-HhTdfl2fzFy1AOcHKP7qg"
+	want := "0f9de62fce790f9a083d5c99e95740ceb90c27ed"
+	for _, url := range []string{"http://mp.weixin.qq.com?params=value", "http://mp.weixin.qq.com?params=value#/home"} {
+		if got := JsSDKSignature(ticket, "Wm3WZYTPz0wzccnW", "1414587457", url); got != want {
+			t.Errorf("JsSDKSignature(%q) = %s, want %s", url, got, want)
+		}
+	}
+}
+
+func TestRandomBase62(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		nonce := randomBase62(16)
+		if len(nonce) != 16 || seen[nonce] {
+			t.Fatalf("expected unique 16 character nonces, got %q", nonce)
+		}
+		if strings.Count(nonce, nonce[:1]) == len(nonce) {
+			t.Fatalf("expected a random nonce, got %q", nonce)
+		}
+		seen[nonce] = true
+	}
+}
+
+func TestWechat_GetJsSDKConfig(t *testing.T) {
+	wx, _ := newTestWechat(t, NewMemoryCache(0))
+	ctx := context.Background()
+	config, err := wx.GetJsSDKConfig(ctx, "https://example.com/page?a=1#section", WithJsAPIList("updateAppMessageShareData"), WithOpenTagList("wx-open-launch-weapp"))
+	if err != nil {
+		t.Fatalf("GetJsSDKConfig returned error: %v", err)
+	}
+	ticket, err := wx.GetJsTicket(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get jsapi ticket: %v", err)
+	}
+	if want := JsSDKSignature(ticket, config.NonceStr, config.Timestamp, "https://example.com/page?a=1"); config.Signature != want {
+		t.Errorf("expected the signature of the url without fragment, got %s", config.Signature)
+	}
+	raw, _ := json.Marshal(config)
+	var wxConfig map[string]any
+	_ = json.Unmarshal(raw, &wxConfig)
+	for _, key := range []string{"debug", "appId", "timestamp", "nonceStr", "signature", "jsApiList", "openTagList"} {
+		if _, ok := wxConfig[key]; !ok {
+			t.Errorf("expected wx.config field %q in %s", key, raw)
+		}
+	}
+
+	config, err = wx.GetJsSDKConfig(ctx, "https://example.com/")
+	if err != nil {
+		t.Fatalf("GetJsSDKConfig returned error: %v", err)
+	}
+	if raw, _ := json.Marshal(config); !strings.Contains(string(raw), `"jsApiList":[]`) || strings.Contains(string(raw), "openTagList") {
+		t.Errorf("expected an empty jsApiList and no openTagList, got %s", raw)
+	}
+}
+
+func TestCardSignature(t *testing.T) {
+	sum := sha1.Sum([]byte("1404896688ojZ8YtyVyr30HheH3CM73y7h4jJEpFS7Fjg8kV1IdDz01r4SQwMkuCKc"))
+	want := hex.EncodeToString(sum[:])
+	if got := CardSignature("ojZ8YtyVyr30HheH3CM73y7h4jJE", "1404896688", "pFS7Fjg8kV1IdDz01r4SQwMkuCKc"); got != want {
+		t.Errorf("CardSignature = %s, want %s", got, want)
+	}
+}
+
+func TestWechat_GetCardTicket(t *testing.T) {
+	wx, srv := newTestWechat(t, NewMemoryCache(0))
+	ctx := context.Background()
+	jsTicket, err := wx.GetJsTicket(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get jsapi ticket: %v", err)
+	}
+	cardTicket, err := wx.GetCardTicket(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get wx_card ticket: %v", err)
+	}
+	if !strings.HasPrefix(cardTicket, "TICKET_wx_card_") || cardTicket == jsTicket {
+		t.Errorf("expected a wx_card ticket, got %q", cardTicket)
+	}
+	if again, _ := wx.GetCardTicket(ctx, false); again != cardTicket {
+		t.Errorf("expected the cached ticket, got %q", again)
+	}
+	if n := len(srv.Calls("/cgi-bin/ticket/getticket")); n != 2 {
+		t.Errorf("expected 2 ticket requests, got %d", n)
+	}
+
+	item, err := wx.GetCardExt(ctx, "pCard", &CardExtRequest{Code: "123", OpenID: "openid"})
+	if err != nil {
+		t.Fatalf("GetCardExt returned error: %v", err)
+	}
+	var ext CardExt
+	err = json.Unmarshal([]byte(item.CardExt), &ext)
+	if err != nil {
+		t.Fatalf("cardExt is not JSON: %v", err)
+	}
+	if item.CardId != "pCard" || ext.Signature != CardSignature(cardTicket, ext.Timestamp, "pCard", "123", "openid", ext.NonceStr) {
+		t.Errorf("unexpected card item %+v", item)
+	}
+
+	config, err := wx.GetChooseCardConfig(ctx, &ChooseCardRequest{CardType: "GROUPON"})
+	if err != nil {
+		t.Fatalf("GetChooseCardConfig returned error: %v", err)
+	}
+	if want := CardSignature(cardTicket, srv.AppID, "", config.Timestamp, config.NonceStr, "", "GROUPON"); config.CardSign != want || config.SignType != "SHA1" {
+		t.Errorf("unexpected chooseCard config %+v", config)
+	}
+}
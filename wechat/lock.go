@@ -0,0 +1,130 @@
+package wechat
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	refreshLockMargin       = 5 * time.Second
+	refreshLockPollInterval = 50 * time.Millisecond
+	// refreshTimeout bounds a refresh when the client has no timeout.
+	refreshTimeout = 30 * time.Second
+)
+
+// refreshLockTTL returns how long a refresh may hold the lock for a client with the given
+// request timeout. A ticket refresh may fetch an access token first, so the refresh may
+// take two requests, and it is cancelled a margin before the lock expires so that it never
+// outlives the lock.
+func refreshLockTTL(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		timeout = refreshTimeout
+	}
+	return 2*timeout + refreshLockMargin
+}
+
+// Locker is a distributed lock shared by replicas that use the same Cache, typically
+// backed by Redis SET NX PX with a random value, and released by a script that deletes
+// the key only if it still holds that value.
+type Locker interface {
+	// TryLock acquires key for ttl without blocking and reports whether it succeeded.
+	// The returned token identifies this holder and must be passed to Unlock.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (token string, ok bool, err error)
+	// Unlock releases key only if it is still held with token. Once the ttl has passed,
+	// the lock may belong to another holder, which Unlock must leave alone.
+	Unlock(ctx context.Context, key string, token string) error
+}
+
+var _ Locker = (*MemoryLocker)(nil)
+
+// MemoryLocker is an in-process Locker. It is meant for tests and for sharing one lock
+// between several Wechat instances in the same process.
+type MemoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]memoryLock
+}
+
+type memoryLock struct {
+	token  string
+	expiry time.Time
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		locks: make(map[string]memoryLock),
+	}
+}
+
+func (l *MemoryLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (string, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if lock, ok := l.locks[key]; ok && now.Before(lock.expiry) {
+		return "", false, nil
+	}
+	token := randomBase62(16)
+	l.locks[key] = memoryLock{token: token, expiry: now.Add(ttl)}
+	return token, true, nil
+}
+
+func (l *MemoryLocker) Unlock(ctx context.Context, key string, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lock, ok := l.locks[key]; ok && lock.token == token {
+		delete(l.locks, key)
+	}
+	return nil
+}
+
+// refreshWithLock runs refresh while holding the refresh lock for the cache kind key, unless
+// the cached value can be reused. A replica that finds the lock taken waits for it and
+// re-reads the cache meanwhile, so it returns as soon as the holder has cached a value that
+// reuse accepts. A holder that only reused the cache leaves the refresh to the waiter.
+// The lock is held for the lockTTL derived from the client timeout, and refresh runs with
+// a context that ends before it.
+func (w *Wechat) refreshWithLock(ctx context.Context, key string, reuse reusable, refresh func(ctx context.Context) (*refreshResult, error)) (*refreshResult, error) {
+	if w.locker == nil {
+		if cached := w.reuseCached(ctx, key, reuse); cached != nil {
+			return cached, nil
+		}
+		return refresh(ctx)
+	}
+	lockKey := w.keys.key(key) + ":lock"
+	for {
+		token, ok, err := w.locker.TryLock(ctx, lockKey, w.lockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			defer func() {
+				_ = w.locker.Unlock(context.WithoutCancel(ctx), lockKey, token)
+			}()
+			if cached := w.reuseCached(ctx, key, reuse); cached != nil {
+				return cached, nil
+			}
+			ctx, cancel := context.WithTimeout(ctx, w.lockTTL-refreshLockMargin)
+			defer cancel()
+			return refresh(ctx)
+		}
+		timer := time.NewTimer(refreshLockPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if cached := w.reuseCached(ctx, key, reuse); cached != nil {
+			return cached, nil
+		}
+	}
+}
+
+// reuseCached returns the cached value of key if reuse accepts it.
+func (w *Wechat) reuseCached(ctx context.Context, key string, reuse reusable) *refreshResult {
+	cached, exist, err := w.cacheGetRefreshed(ctx, key)
+	if err != nil || !exist || !reuse(cached) {
+		return nil
+	}
+	return cached
+}
@@ -0,0 +1,166 @@
+package wechat
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+)
+
+func TestMemoryLocker(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	token, ok, _ := locker.TryLock(ctx, "k", time.Minute)
+	if !ok || token == "" {
+		t.Fatal("expected first TryLock to succeed with a token")
+	}
+	_, ok, _ = locker.TryLock(ctx, "k", time.Minute)
+	if ok {
+		t.Fatal("expected second TryLock to fail while held")
+	}
+	_ = locker.Unlock(ctx, "k", token)
+	expired, ok, _ := locker.TryLock(ctx, "k", time.Millisecond)
+	if !ok {
+		t.Fatal("expected TryLock to succeed after Unlock")
+	}
+	time.Sleep(5 * time.Millisecond)
+	token, ok, _ = locker.TryLock(ctx, "k", time.Minute)
+	if !ok {
+		t.Fatal("expected TryLock to succeed after the lock expired")
+	}
+	// the holder whose lock expired must not release the new holder's lock
+	_ = locker.Unlock(ctx, "k", expired)
+	_, ok, _ = locker.TryLock(ctx, "k", time.Minute)
+	if ok {
+		t.Fatal("expected Unlock with a stale token to leave the lock held")
+	}
+	_ = locker.Unlock(ctx, "k", token)
+	_, ok, _ = locker.TryLock(ctx, "k", time.Minute)
+	if !ok {
+		t.Fatal("expected Unlock with the current token to release the lock")
+	}
+}
+
+func TestWechat_WithLocker_SingleRefreshAcrossReplicas(t *testing.T) {
+	srv := wechattest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.Handle("/cgi-bin/token", func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond) // keep the refresh in flight while the other replicas arrive
+		wechattest.WriteJSON(rw, http.StatusOK, map[string]any{"access_token": srv.IssueAccessToken(), "expires_in": 7200})
+	})
+
+	cache := NewMemoryCache(0)
+	locker := NewMemoryLocker()
+	config := Config{AppID: srv.AppID, AppSecret: srv.AppSecret}
+	replicas := make([]*Wechat, 20)
+	for i := range replicas {
+		replicas[i] = NewWechat(config, cache, WithBaseURL(srv.URL), WithLocker(locker))
+	}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, len(replicas))
+	errs := make([]error, len(replicas))
+	for i, wx := range replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], errs[i] = wx.GetAccessToken(context.Background(), false)
+		}()
+	}
+	wg.Wait()
+
+	for i := range replicas {
+		if errs[i] != nil {
+			t.Fatalf("replica %d failed: %v", i, errs[i])
+		}
+		if tokens[i] != tokens[0] {
+			t.Errorf("replica %d got token %q, want %q", i, tokens[i], tokens[0])
+		}
+	}
+	if n := len(srv.Calls("/cgi-bin/token")); n != 1 {
+		t.Errorf("expected a single token refresh, got %d", n)
+	}
+}
+
+// holdRefreshLock takes the refresh lock of kind like a replica that only reads the cache,
+// and releases it after d without caching anything.
+func holdRefreshLock(t *testing.T, wx *Wechat, kind string, d time.Duration) {
+	t.Helper()
+	ctx := context.Background()
+	lockKey := wx.keys.key(kind) + ":lock"
+	token, ok, _ := wx.locker.TryLock(ctx, lockKey, time.Minute)
+	if !ok {
+		t.Fatal("failed to take the refresh lock")
+	}
+	time.AfterFunc(d, func() {
+		_ = wx.locker.Unlock(ctx, lockKey, token)
+	})
+}
+
+func TestWechat_WithLocker_ReloadAfterReadOnlyHolder(t *testing.T) {
+	srv := wechattest.NewServer()
+	t.Cleanup(srv.Close)
+	config := Config{AppID: srv.AppID, AppSecret: srv.AppSecret}
+	wx := NewWechat(config, NewMemoryCache(0), WithBaseURL(srv.URL), WithLocker(NewMemoryLocker()))
+	ctx := context.Background()
+	rejected, err := wx.GetAccessToken(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get access token: %v", err)
+	}
+
+	holdRefreshLock(t, wx, cacheKindAccessToken, 150*time.Millisecond)
+	srv.FailNext("/cgi-bin/message/subscribe/send", ErrCodeInvalidCredential, "invalid credential")
+	err = wx.SendMessage(ctx, &SubscribeMessageRequest{TemplateID: "tpl", ToUser: "openid"})
+	if err != nil {
+		t.Fatalf("expected the call to succeed with a new token, got %v", err)
+	}
+	calls := srv.Calls("/cgi-bin/message/subscribe/send")
+	if len(calls) != 2 || calls[1].Query.Get("access_token") == rejected {
+		t.Errorf("expected the retry to use a new token, got %d calls", len(calls))
+	}
+	if n := len(srv.Calls("/cgi-bin/token")); n != 2 {
+		t.Errorf("expected the reload to fetch a token after waiting, got %d token calls", n)
+	}
+}
+
+func TestWechat_WithLocker_ForceRefreshAfterReadOnlyHolder(t *testing.T) {
+	srv := wechattest.NewServer()
+	t.Cleanup(srv.Close)
+	config := Config{AppID: srv.AppID, AppSecret: srv.AppSecret, StableToken: true}
+	wx := NewWechat(config, NewMemoryCache(0), WithBaseURL(srv.URL), WithLocker(NewMemoryLocker()))
+	ctx := context.Background()
+	stale, err := wx.GetAccessToken(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get access token: %v", err)
+	}
+
+	holdRefreshLock(t, wx, cacheKindAccessToken, 150*time.Millisecond)
+	token, err := wx.ForceRefreshAccessToken(ctx)
+	if err != nil {
+		t.Fatalf("ForceRefreshAccessToken returned error: %v", err)
+	}
+	if token == stale {
+		t.Error("expected the force refresh not to return the token cached before it started")
+	}
+	calls := srv.Calls("/cgi-bin/stable_token")
+	if len(calls) != 2 || !strings.Contains(string(calls[1].Body), `"force_refresh":true`) {
+		t.Errorf("expected a forced stable_token call after waiting, got %d calls", len(calls))
+	}
+}
+
+func TestRefreshLockTTL(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second, 30 * time.Second, 2 * time.Minute} {
+		ttl := refreshLockTTL(timeout)
+		if ttl-refreshLockMargin < 2*timeout || ttl-refreshLockMargin < 2*time.Second {
+			t.Errorf("timeout %v: lock ttl %v does not cover two requests", timeout, ttl)
+		}
+	}
+	wx := NewWechat(Config{AppID: "wx123", AppSecret: "secret"}, &nopCache{}, WithTimeout(time.Minute))
+	if wx.lockTTL <= time.Minute {
+		t.Errorf("expected the lock to outlive a request, got %v", wx.lockTTL)
+	}
+}
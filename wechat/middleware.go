@@ -0,0 +1,266 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redactedKeys are the query, form and JSON keys whose values never reach a Middleware.
+var redactedKeys = map[string]bool{
+	"access_token":  true,
+	"secret":        true,
+	"appsecret":     true,
+	"session_key":   true,
+	"refresh_token": true,
+	"js_code":       true,
+	"code":          true,
+	"signature":     true,
+}
+
+const redacted = "REDACTED"
+
+// CallInfo describes one HTTP exchange with the WeChat API as seen by a Middleware.
+// Request fields are set before next is called, response fields once it returns.
+// Credentials such as access_token, secret, session_key and login codes are redacted.
+type CallInfo struct {
+	Endpoint       string        // 接口路径，如 /wxa/getwxacodeunlimit
+	Method         string        // HTTP 方法
+	Query          url.Values    // 请求参数
+	RequestBody    []byte        // 请求体
+	StatusCode     int           // HTTP 状态码，请求未完成时为 0
+	ResponseHeader http.Header   // 响应头
+	ResponseBody   []byte        // JSON 响应体，图片等其它响应为 nil
+	Err            error         // 网络错误，或响应中的 errcode 错误
+	Duration       time.Duration // 请求耗时
+}
+
+// Middleware wraps every HTTP exchange with the WeChat API, including token refreshes
+// and retries. Handle must call next to send the request, and may pass it a derived
+// context; returning an error without calling next aborts the call.
+type Middleware interface {
+	Handle(ctx context.Context, call *CallInfo, next func(ctx context.Context) error) error
+}
+
+// MiddlewareFunc adapts a function to the Middleware interface.
+type MiddlewareFunc func(ctx context.Context, call *CallInfo, next func(ctx context.Context) error) error
+
+func (f MiddlewareFunc) Handle(ctx context.Context, call *CallInfo, next func(ctx context.Context) error) error {
+	return f(ctx, call, next)
+}
+
+// WithMiddleware adds middlewares around every HTTP exchange. The first one is the outermost.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(opts *options) {
+		opts.middlewares = append(opts.middlewares, middlewares...)
+	}
+}
+
+// middlewareTransport runs the middleware chain around the underlying transport.
+type middlewareTransport struct {
+	next        http.RoundTripper
+	middlewares []Middleware
+}
+
+func (t *middlewareTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call, req, err := newCallInfo(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp *http.Response
+	handler := func(ctx context.Context) error {
+		start := time.Now()
+		var err error
+		resp, err = t.next.RoundTrip(req.WithContext(ctx))
+		call.Duration = time.Since(start)
+		if err != nil {
+			call.Err = err
+			return err
+		}
+		return call.readResponse(resp)
+	}
+	for i := len(t.middlewares) - 1; i >= 0; i-- {
+		m, next := t.middlewares[i], handler
+		handler = func(ctx context.Context) error {
+			return m.Handle(ctx, call, next)
+		}
+	}
+	err = handler(req.Context())
+	if err != nil {
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// newCallInfo describes req with its credentials redacted. The body is read from a copy
+// when req can provide one; otherwise it is buffered into a shallow copy of req, which is
+// returned to be sent instead.
+func newCallInfo(req *http.Request) (*CallInfo, *http.Request, error) {
+	call := &CallInfo{
+		Endpoint: req.URL.Path,
+		Method:   req.Method,
+		Query:    redactValues(req.URL.Query()),
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return call, req, nil
+	}
+	body, err := readBodyCopy(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body == nil {
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		req = req.WithContext(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err == nil {
+			call.RequestBody = []byte(redactValues(form).Encode())
+			return call, req, nil
+		}
+	}
+	call.RequestBody = redactJSON(body)
+	return call, req, nil
+}
+
+// readBodyCopy reads the body of req through GetBody, leaving req.Body untouched.
+// It returns nil if req cannot provide a copy.
+func readBodyCopy(req *http.Request) ([]byte, error) {
+	if req.GetBody == nil {
+		return nil, nil
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	body, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		body = []byte{}
+	}
+	return body, nil
+}
+
+// readResponse buffers the response body, leaving resp readable by the client.
+func (c *CallInfo) readResponse(resp *http.Response) error {
+	c.StatusCode = resp.StatusCode
+	c.ResponseHeader = resp.Header.Clone()
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		c.Err = err
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if !json.Valid(body) {
+		return nil
+	}
+	c.ResponseBody = redactJSON(body)
+	var result ErrResponse
+	if json.Unmarshal(body, &result) == nil && result.ErrCode != 0 {
+		errResp := checkResponseError(result.ErrCode, result.ErrMsg).(ErrResponse)
+		errResp.Endpoint = c.Endpoint
+		errResp.Response = &ResponseInfo{HTTPStatus: c.StatusCode, Latency: c.Duration, Header: c.ResponseHeader}
+		c.Err = errResp
+	}
+	return nil
+}
+
+func redactValues(values url.Values) url.Values {
+	for key := range values {
+		if redactedKeys[key] {
+			values[key] = []string{redacted}
+		}
+	}
+	return values
+}
+
+// redactJSON returns body with the values of redacted keys replaced, or body itself if it is not JSON.
+// Numbers are decoded as json.Number so that large IDs such as msgid are kept exactly.
+func redactJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v any
+	if decoder.Decode(&v) != nil || decoder.More() {
+		return body
+	}
+	if !redactValue(v) {
+		return body
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return raw
+}
+
+func redactValue(v any) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if redactedKeys[key] {
+				v[key] = redacted
+				changed = true
+			} else if redactValue(value) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if redactValue(value) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// NewSlogMiddleware logs every exchange with the WeChat API to logger: successful calls at
+// Info and failed ones at Warn, with the endpoint, status, errcode and duration. The redacted
+// request and response bodies are included when logger is enabled for Debug.
+func NewSlogMiddleware(logger *slog.Logger) Middleware {
+	return MiddlewareFunc(func(ctx context.Context, call *CallInfo, next func(ctx context.Context) error) error {
+		err := next(ctx)
+		level := slog.LevelInfo
+		attrs := []slog.Attr{
+			slog.String("endpoint", call.Endpoint),
+			slog.String("method", call.Method),
+			slog.Int("status", call.StatusCode),
+			slog.Duration("duration", call.Duration),
+		}
+		if call.Err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", call.Err.Error()))
+			if code := ErrCodeOf(call.Err); code != 0 {
+				attrs = append(attrs, slog.Int("errcode", code), slog.String("rid", RidOf(call.Err)))
+			}
+		}
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs,
+				slog.String("query", call.Query.Encode()),
+				slog.String("request", string(call.RequestBody)),
+				slog.String("response", string(call.ResponseBody)),
+			)
+		}
+		logger.LogAttrs(ctx, level, "wechat api call", attrs...)
+		return err
+	})
+}
@@ -0,0 +1,173 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+)
+
+type recordingMiddleware struct {
+	mu    sync.Mutex
+	calls []CallInfo
+}
+
+func (m *recordingMiddleware) Handle(ctx context.Context, call *CallInfo, next func(ctx context.Context) error) error {
+	err := next(ctx)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, *call)
+	return err
+}
+
+func TestMiddleware_Redaction(t *testing.T) {
+	rec := &recordingMiddleware{}
+	wx, srv := newTestWechat(t, &nopCache{}, WithMiddleware(rec))
+	ctx := context.Background()
+	session, err := wx.JsCode2Session(ctx, "code1")
+	if err != nil {
+		t.Fatalf("JsCode2Session returned error: %v", err)
+	}
+	if session.SessionKey != wechattest.SessionKey("code1") {
+		t.Errorf("middleware changed the response seen by the client: %+v", session)
+	}
+	_, err = wx.GetUserPhoneNumber(ctx, "code2")
+	if err != nil {
+		t.Fatalf("GetUserPhoneNumber returned error: %v", err)
+	}
+	if len(rec.calls) != 3 {
+		t.Fatalf("expected 3 recorded calls, got %d", len(rec.calls))
+	}
+	for _, call := range rec.calls {
+		all := call.Query.Encode() + string(call.RequestBody) + string(call.ResponseBody)
+		for _, secret := range []string{srv.AppSecret, wechattest.SessionKey("code1"), "ACCESS_TOKEN_"} {
+			if strings.Contains(all, secret) {
+				t.Errorf("%s: %q leaked in %s", call.Endpoint, secret, all)
+			}
+		}
+		if call.StatusCode != 200 || call.Duration <= 0 {
+			t.Errorf("%s: unexpected status %d or duration %v", call.Endpoint, call.StatusCode, call.Duration)
+		}
+	}
+	if q := rec.calls[0].Query; rec.calls[0].Endpoint != "/sns/jscode2session" || q.Get("secret") != "REDACTED" || q.Get("js_code") != "REDACTED" {
+		t.Errorf("unexpected first call %+v", rec.calls[0])
+	}
+	if rec.calls[2].Endpoint != "/wxa/business/getuserphonenumber" || string(rec.calls[2].RequestBody) != `{"code":"REDACTED"}` {
+		t.Errorf("unexpected last call %+v", rec.calls[2])
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	body := []byte(`{"msgid":3782613483279187968,"signature":"abc","list":[{"session_key":"key","n":1.5}]}`)
+	want := `{"list":[{"n":1.5,"session_key":"REDACTED"}],"msgid":3782613483279187968,"signature":"REDACTED"}`
+	if got := string(redactJSON(body)); got != want {
+		t.Errorf("redactJSON =\n%s\nwant\n%s", got, want)
+	}
+	for _, body := range []string{`{"msgid":3782613483279187968}`, `not json`, `{"code":"a"} trailing`} {
+		if got := string(redactJSON([]byte(body))); got != body {
+			t.Errorf("expected %s to be kept as is, got %s", body, got)
+		}
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestMiddleware_RequestBodyUntouched(t *testing.T) {
+	const body = `{"code":"code1"}`
+	var sent []byte
+	var sentBody io.ReadCloser
+	transport := &middlewareTransport{
+		next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sentBody = req.Body
+			sent, _ = io.ReadAll(req.Body)
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+		}),
+		middlewares: []Middleware{&recordingMiddleware{}},
+	}
+	for name, getBody := range map[string]bool{"with GetBody": true, "without GetBody": false} {
+		req, _ := http.NewRequest(http.MethodPost, "https://api.weixin.qq.com/wxa/business/getuserphonenumber", strings.NewReader(body))
+		if !getBody {
+			req.GetBody = nil
+		}
+		original := req.Body
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: RoundTrip returned error: %v", name, err)
+		}
+		_ = resp.Body.Close()
+		if string(sent) != body {
+			t.Errorf("%s: expected the body to be sent unchanged, got %s", name, sent)
+		}
+		if req.Body != original {
+			t.Errorf("%s: expected the body of the caller's request to be kept", name)
+		}
+		if getBody && sentBody != original {
+			t.Errorf("%s: expected the original body to be sent", name)
+		}
+	}
+}
+
+func TestMiddleware_ChainAndErrors(t *testing.T) {
+	type ctxKey struct{}
+	var order []string
+	outer := MiddlewareFunc(func(ctx context.Context, call *CallInfo, next func(ctx context.Context) error) error {
+		order = append(order, "outer")
+		return next(context.WithValue(ctx, ctxKey{}, "outer"))
+	})
+	var seenErr error
+	inner := MiddlewareFunc(func(ctx context.Context, call *CallInfo, next func(ctx context.Context) error) error {
+		order = append(order, "inner:"+ctx.Value(ctxKey{}).(string))
+		err := next(ctx)
+		seenErr = call.Err
+		return err
+	})
+	wx, srv := newTestWechat(t, &nopCache{}, WithMiddleware(outer, inner))
+	srv.FailNext("/sns/jscode2session", ErrCodeInvalidCode, "invalid code")
+	_, err := wx.JsCode2Session(context.Background(), "code1")
+	if !errors.Is(err, ErrorInvalidCode) || !errors.Is(seenErr, ErrorInvalidCode) {
+		t.Errorf("expected ErrorInvalidCode from client and middleware, got %v and %v", err, seenErr)
+	}
+	if strings.Join(order, ",") != "outer,inner:outer" {
+		t.Errorf("unexpected order %v", order)
+	}
+
+	denied := errors.New("denied")
+	wx, srv = newTestWechat(t, &nopCache{}, WithMiddleware(MiddlewareFunc(func(ctx context.Context, call *CallInfo, next func(ctx context.Context) error) error {
+		return denied
+	})))
+	_, err = wx.JsCode2Session(context.Background(), "code1")
+	if !errors.Is(err, denied) {
+		t.Errorf("expected middleware error, got %v", err)
+	}
+	if n := len(srv.Calls("")); n != 0 {
+		t.Errorf("expected no call to reach the server, got %d", n)
+	}
+}
+
+func TestSlogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	wx, srv := newTestWechat(t, &nopCache{}, WithMiddleware(NewSlogMiddleware(logger)))
+	srv.FailNext("/cgi-bin/message/subscribe/send", ErrCodeUserRefused, "user refuse to accept the msg rid: 64f1e6c6-1b2a3c4d-5e6f7a8b")
+	_ = wx.SendMessage(context.Background(), &SubscribeMessageRequest{TemplateID: "tpl", ToUser: "openid"})
+	out := buf.String()
+	for _, want := range []string{`"level":"INFO"`, `"endpoint":"/cgi-bin/token"`, `"level":"WARN"`, `"errcode":43101`, `"rid":"64f1e6c6-1b2a3c4d-5e6f7a8b"`, `\"touser\":\"openid\"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %s, got %s", want, out)
+		}
+	}
+	if strings.Contains(out, srv.AppSecret) || strings.Contains(out, "ACCESS_TOKEN_") {
+		t.Errorf("log leaks credentials: %s", out)
+	}
+}
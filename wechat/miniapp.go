@@ -2,12 +2,32 @@ package wechat
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 )
 
+var (
+	ErrorInvalidQrCodeWidth = errors.New("invalid qrcode width")
+	ErrorInvalidQrCodeScene = errors.New("invalid qrcode scene")
+	ErrorInvalidQrCodePath  = errors.New("invalid qrcode path")
+)
+
+const (
+	minQrCodeWidth   = 280
+	maxQrCodeWidth   = 1280
+	maxSceneLength   = 32
+	maxWxaCodePath   = 1024
+	maxWxaQrCodePath = 128
+	// sceneSpecialChars are the characters allowed in a scene besides ASCII letters and digits.
+	sceneSpecialChars = "!#$&'()*+,/:;=?@-._~"
+)
+
+// JsCode2Session exchanges the js_code returned by wx.login for the openid and session key.
+// The code can only be used once, so the call is never replayed on a backup host.
 func (w *Wechat) JsCode2Session(ctx context.Context, code string) (*JsCode2SessionResponse, error) {
 	resp, err := w.client.R().
-		Clone(ctx).
+		Clone(withNoReplay(ctx)).
 		SetHeader("Accept", "application/json").
 		SetQueryParams(map[string]string{
 			"appid":      w.config.AppID,
@@ -24,36 +44,104 @@ func (w *Wechat) JsCode2Session(ctx context.Context, code string) (*JsCode2Sessi
 	})
 }
 
+// GetQrCode returns a mini-program code for a scene, with no limit on the number of codes.
+// The request is validated before it is sent.
 func (w *Wechat) GetQrCode(ctx context.Context, code *QrCodeRequest, options ...RequestOption) ([]byte, error) {
-	type Image struct {
-		raw []byte
+	err := validateScene(code.Scene)
+	if err != nil {
+		return nil, err
 	}
-	image, err := withAccessToken[Image](ctx, w, func(ctx context.Context, accessToken string) (*Image, error) {
-		resp, err := w.client.R().
-			Clone(ctx).
-			SetQueryParams(map[string]string{
-				"access_token": accessToken,
-			}).
-			SetBody(code).
-			Post("/wxa/getwxacodeunlimit")
-		if err != nil {
-			return nil, err
-		}
-		res := resp.Bytes()
-		if resp.StatusCode() == 200 {
-			return &Image{raw: res}, nil
-		}
-		var errResp ErrResponse
-		err = json.Unmarshal(res, &errResp)
-		if err != nil {
-			return nil, err
-		}
-		return nil, &errResp
-	}, options...)
+	err = validateQrCodeWidth(code.Width)
+	if err != nil {
+		return nil, err
+	}
+	err = validateLineColor(code.LineColor)
 	if err != nil {
 		return nil, err
 	}
-	return image.raw, nil
+	return w.download(ctx, "/wxa/getwxacodeunlimit", nil, code, options...)
+}
+
+// GetWxaCode returns a mini-program code for a page path with query. Together with
+// CreateWxaQrCode, at most 100,000 codes can be created for an app.
+func (w *Wechat) GetWxaCode(ctx context.Context, code *WxaCodeRequest, options ...RequestOption) ([]byte, error) {
+	err := validateQrCodePath(code.Path, maxWxaCodePath)
+	if err != nil {
+		return nil, err
+	}
+	err = validateQrCodeWidth(code.Width)
+	if err != nil {
+		return nil, err
+	}
+	err = validateLineColor(code.LineColor)
+	if err != nil {
+		return nil, err
+	}
+	return w.download(ctx, "/wxa/getwxacode", nil, code, options...)
+}
+
+// CreateWxaQrCode returns a classic square QR code for a page path with query. Together
+// with GetWxaCode, at most 100,000 codes can be created for an app.
+func (w *Wechat) CreateWxaQrCode(ctx context.Context, code *WxaQrCodeRequest, options ...RequestOption) ([]byte, error) {
+	err := validateQrCodePath(code.Path, maxWxaQrCodePath)
+	if err != nil {
+		return nil, err
+	}
+	err = validateQrCodeWidth(code.Width)
+	if err != nil {
+		return nil, err
+	}
+	return w.download(ctx, "/cgi-bin/wxaapp/createwxaqrcode", nil, code, options...)
+}
+
+// validateQrCodeWidth accepts 0 for the default width, or a width within the allowed range.
+func validateQrCodeWidth(width int) error {
+	if width != 0 && (width < minQrCodeWidth || width > maxQrCodeWidth) {
+		return fmt.Errorf("%w: %d is outside %d-%d", ErrorInvalidQrCodeWidth, width, minQrCodeWidth, maxQrCodeWidth)
+	}
+	return nil
+}
+
+func validateScene(scene string) error {
+	if scene == "" || len(scene) > maxSceneLength {
+		return fmt.Errorf("%w: must be 1-%d characters, got %d", ErrorInvalidQrCodeScene, maxSceneLength, len(scene))
+	}
+	for _, c := range scene {
+		if !isSceneChar(c) {
+			return fmt.Errorf("%w: character %q is not allowed", ErrorInvalidQrCodeScene, c)
+		}
+	}
+	return nil
+}
+
+func isSceneChar(c rune) bool {
+	switch {
+	case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	default:
+		return strings.ContainsRune(sceneSpecialChars, c)
+	}
+}
+
+// validateQrCodePath checks the length of path in bytes, like the scene.
+func validateQrCodePath(path string, maxLength int) error {
+	if path == "" || len(path) > maxLength {
+		return fmt.Errorf("%w: must be 1-%d bytes, got %d", ErrorInvalidQrCodePath, maxLength, len(path))
+	}
+	return nil
+}
+
+// validateLineColor accepts nil for the default color, or components within 0-255.
+func validateLineColor(color *LineColor) error {
+	if color == nil {
+		return nil
+	}
+	for _, c := range []int{color.R, color.G, color.B} {
+		if c < 0 || c > 255 {
+			return fmt.Errorf("%w: line color %+v is outside 0-255", ErrorInvalidArgument, *color)
+		}
+	}
+	return nil
 }
 
 func (w *Wechat) SendMessage(ctx context.Context, msg *SubscribeMessageRequest, options ...RequestOption) error {
@@ -88,7 +176,7 @@ func (w *Wechat) SendMessage(ctx context.Context, msg *SubscribeMessageRequest,
 			return nil, err
 		}
 		return nil, nil
-	}, options...)
+	}, append([]RequestOption{withNonIdempotent()}, options...)...)
 	return err
 }
 
@@ -100,8 +188,6 @@ func (w *Wechat) GetUserPhoneNumber(ctx context.Context, code string, options ..
 				"access_token": accessToken,
 			}).
 			SetBody(map[string]string{"code": code}).
-			SetResult(GetUserPhoneNumberResponse{}).
-			SetError(ErrResponse{}).
 			Post("/wxa/business/getuserphonenumber")
 		if err != nil {
 			return nil, err
@@ -2,57 +2,30 @@ package wechat
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	"resty.dev/v3"
 )
 
-const (
-	// ErrCodeInvalidCredential 40001 获取access_token时AppSecret错误，或者access_token无效
-	ErrCodeInvalidCredential = 40001
-	// ErrCodeAccessTokenExpired 42001 access_token超时
-	ErrCodeAccessTokenExpired = 42001
-	// ErrCodeInvalidAccessToken 40014 不合法的access_token，请开发者认真比对access_token的有效性（如是否过期），或查看是否正在为恰当的公众号调用接口
-	ErrCodeInvalidAccessToken = 40014
-)
-
-var (
-	ErrorInvalidCredential  = errors.New("invalid credential")
-	ErrorAccessTokenExpired = errors.New("access token expired")
-	ErrorInvalidAccessToken = errors.New("invalid access token")
-)
+//go:generate go run ./internal/errcodegen -in errcodes.csv -out errcodes_gen.go
 
 // isNeedRetryError determines if an error is recoverable and should trigger a retry.
 // It checks for credential and access token errors that can be resolved by refreshing tokens.
 func isNeedRetryError(err error) bool {
-	if errors.Is(err, ErrorInvalidCredential) {
-		return true
-	}
-	if errors.Is(err, ErrorAccessTokenExpired) {
-		return true
-	}
-	if errors.Is(err, ErrorInvalidAccessToken) {
-		return true
-	}
-	return false
+	return hasErrCodeFlag(err, errFlagToken)
 }
 
 // checkResponseError converts WeChat API error codes to Go errors.
-// It maps common error codes to predefined error instances for consistent error handling.
+// The returned ErrResponse matches the catalog sentinels such as ErrorInvalidCredential with
+// errors.Is only; it is never equal to them with ==.
 func checkResponseError(errCode int, errMsg string) error {
-	switch errCode {
-	case ErrCodeInvalidCredential:
-		return ErrorInvalidCredential
-	case ErrCodeAccessTokenExpired:
-		return ErrorAccessTokenExpired
-	case ErrCodeInvalidAccessToken:
-		return ErrorInvalidAccessToken
-	}
 	if errCode != 0 {
 		return ErrResponse{
 			ErrCode: errCode,
 			ErrMsg:  errMsg,
+			Rid:     parseRid(errMsg),
 		}
 	}
 	return nil
@@ -62,10 +35,13 @@ func loadSuccessResponse[T any](resp *resty.Response, check func(*T) error) (*T,
 	if resp.IsError() {
 		var result ErrResponse
 		err := json.Unmarshal(resp.Bytes(), &result)
-		if err != nil {
-			return nil, err
+		if err != nil || result.ErrCode == 0 {
+			return nil, newHTTPError(resp)
+		}
+		if result.Rid == "" {
+			result.Rid = parseRid(result.ErrMsg)
 		}
-		return nil, result
+		return nil, withResponse(result, resp)
 	}
 	if resp.IsSuccess() {
 		var result T
@@ -75,20 +51,47 @@ func loadSuccessResponse[T any](resp *resty.Response, check func(*T) error) (*T,
 		}
 		err = check(&result)
 		if err != nil {
-			return nil, err
+			return nil, withResponse(err, resp)
 		}
 		return &result, nil
 	}
-	return nil, fmt.Errorf("unknown error: %s", resp.Status())
+	return nil, newHTTPError(resp)
 }
 
+// ErrResponse is the error returned for a non-zero errcode. It is not one of the catalog
+// sentinels such as ErrorInvalidCredential, so errors must be compared with errors.Is,
+// or inspected with errors.As and ErrCodeOf, rather than with ==.
 type ErrResponse struct {
-	ErrCode int    `json:"errcode"`
-	ErrMsg  string `json:"errmsg"`
+	ErrCode  int           `json:"errcode"`
+	ErrMsg   string        `json:"errmsg"`
+	Rid      string        `json:"rid,omitempty"` // 请求 ID，可用于 /cgi-bin/openapi/rid/get 查询详情
+	Endpoint string        `json:"-"`             // 出错的接口路径
+	Response *ResponseInfo `json:"-"`             // 出错的 HTTP 响应，未发出请求时为 nil
+}
+
+// ResponseInfo describes the HTTP response that carried an ErrResponse. It is kept behind
+// a pointer so that ErrResponse stays comparable.
+type ResponseInfo struct {
+	HTTPStatus int           // HTTP 状态码
+	Latency    time.Duration // 请求耗时
+	Header     http.Header   // 响应头
 }
 
 func (e ErrResponse) Error() string {
-	return e.ErrMsg
+	if e.Endpoint != "" {
+		return fmt.Sprintf("wechat %s: errcode %d: %s", e.Endpoint, e.ErrCode, e.ErrMsg)
+	}
+	return fmt.Sprintf("wechat: errcode %d: %s", e.ErrCode, e.ErrMsg)
+}
+
+// Is reports whether target is the catalog sentinel for e.ErrCode, such as ErrorQuotaExceeded
+// for 45009, or an ErrResponse with the same ErrCode.
+func (e ErrResponse) Is(target error) bool {
+	if info, ok := errCodeCatalog[e.ErrCode]; ok && info.err == target {
+		return true
+	}
+	t, ok := target.(ErrResponse)
+	return ok && t.ErrCode == e.ErrCode
 }
 
 type JsCode2SessionResponse struct {
@@ -98,7 +101,14 @@ type JsCode2SessionResponse struct {
 	UnionID    string `json:"unionid"`
 }
 
+type ResetUserSessionKeyResponse struct {
+	ErrResponse
+	OpenID     string `json:"openid"`      // 用户唯一标识
+	SessionKey string `json:"session_key"` // 重置后的会话密钥
+}
+
 type SnsOauth2Response struct {
+	ErrResponse
 	AccessToken    string `json:"access_token"`
 	ExpiresIn      int    `json:"expires_in"`
 	RefreshToken   string `json:"refresh_token"`
@@ -108,6 +118,19 @@ type SnsOauth2Response struct {
 	UnionID        string `json:"unionid"`
 }
 
+type SnsUserInfoResponse struct {
+	ErrResponse
+	OpenID     string   `json:"openid"`     // 用户的唯一标识
+	Nickname   string   `json:"nickname"`   // 用户昵称
+	Sex        int      `json:"sex"`        // 用户的性别，1 为男性，2 为女性，0 为未知
+	Province   string   `json:"province"`   // 用户个人资料填写的省份
+	City       string   `json:"city"`       // 普通用户个人资料填写的城市
+	Country    string   `json:"country"`    // 国家，如中国为 CN
+	HeadImgURL string   `json:"headimgurl"` // 用户头像，用户没有头像时为空
+	Privilege  []string `json:"privilege"`  // 用户特权信息
+	UnionID    string   `json:"unionid"`    // 只有在用户将公众号绑定到微信开放平台账号后，才会出现该字段
+}
+
 type AccessTokenResponse struct {
 	ErrResponse
 	AccessToken string `json:"access_token"`
@@ -121,14 +144,36 @@ type JsTicketResponse struct {
 }
 
 type QrCodeRequest struct {
-	Scene      string `json:"scene,omitempty"`       // 最大32个可见字符，只支持数字，大小写英文以及部分特殊字符：!#$&'()*+,/:;=?@-._~，其它字符请自行编码为合法字符（因不支持%，中文无法使用 urlencode 处理，请使用其他编码方式）
-	Page       string `json:"page,omitempty"`        // 默认是主页，页面 page，例如 pages/index/index，根路径前不要填加 /，不能携带参数（参数请放在scene字段里），如果不填写这个字段，默认跳主页面。scancode_time为系统保留参数，不允许配置
-	CheckPath  bool   `json:"check_path,omitempty"`  // 默认是true，检查page 是否存在，为 true 时 page 必须是已经发布的小程序存在的页面（否则报错）；为 false 时允许小程序未发布或者 page 不存在， 但page 有数量上限（60000个）请勿滥用。
-	EnvVersion string `json:"env_version,omitempty"` // 要打开的小程序版本。正式版为 "release"，体验版为 "trial"，开发版为 "develop"。默认是正式版。
-	Width      int    `json:"width,omitempty"`       // 默认430，二维码的宽度，单位 px，最小 280px，最大 1280px
-	AutoColor  bool   `json:"auto_color,omitempty"`  // 自动配置线条颜色，如果颜色依然是黑色，则说明不建议配置主色调，默认 false
-	LineColor  string `json:"line_color,omitempty"`  // 默认是{"r":0,"g":0,"b":0} 。auto_color 为 false 时生效，使用 rgb 设置颜色 例如 {"r":"xxx","g":"xxx","b":"xxx"} 十进制表示
-	IsHyaline  bool   `json:"is_hyaline,omitempty"`  // 默认是false，是否需要透明底色，为 true 时，生成透明底色的小程序
+	Scene      string     `json:"scene,omitempty"`       // 最大32个可见字符，只支持数字，大小写英文以及部分特殊字符：!#$&'()*+,/:;=?@-._~，其它字符请自行编码为合法字符（因不支持%，中文无法使用 urlencode 处理，请使用其他编码方式）
+	Page       string     `json:"page,omitempty"`        // 默认是主页，页面 page，例如 pages/index/index，根路径前不要填加 /，不能携带参数（参数请放在scene字段里），如果不填写这个字段，默认跳主页面。scancode_time为系统保留参数，不允许配置
+	CheckPath  bool       `json:"check_path,omitempty"`  // 默认是true，检查page 是否存在，为 true 时 page 必须是已经发布的小程序存在的页面（否则报错）；为 false 时允许小程序未发布或者 page 不存在， 但page 有数量上限（60000个）请勿滥用。
+	EnvVersion string     `json:"env_version,omitempty"` // 要打开的小程序版本。正式版为 "release"，体验版为 "trial"，开发版为 "develop"。默认是正式版。
+	Width      int        `json:"width,omitempty"`       // 默认430，二维码的宽度，单位 px，最小 280px，最大 1280px
+	AutoColor  bool       `json:"auto_color,omitempty"`  // 自动配置线条颜色，如果颜色依然是黑色，则说明不建议配置主色调，默认 false
+	LineColor  *LineColor `json:"line_color,omitempty"`  // 默认是{"r":0,"g":0,"b":0} 。auto_color 为 false 时生效，使用 rgb 设置颜色
+	IsHyaline  bool       `json:"is_hyaline,omitempty"`  // 默认是false，是否需要透明底色，为 true 时，生成透明底色的小程序
+}
+
+// LineColor is the RGB color of the lines of a mini-program code, each component in 0-255.
+// Other values are rejected with ErrorInvalidArgument before the request is sent.
+type LineColor struct {
+	R int `json:"r"`
+	G int `json:"g"`
+	B int `json:"b"`
+}
+
+type WxaCodeRequest struct {
+	Path       string     `json:"path"`                  // 扫码进入的小程序页面路径，最大长度 1024 字节，可以携带参数，例如 pages/index/index?foo=bar
+	EnvVersion string     `json:"env_version,omitempty"` // 要打开的小程序版本。正式版为 "release"，体验版为 "trial"，开发版为 "develop"。默认是正式版。
+	Width      int        `json:"width,omitempty"`       // 默认430，二维码的宽度，单位 px，最小 280px，最大 1280px
+	AutoColor  bool       `json:"auto_color,omitempty"`  // 自动配置线条颜色，默认 false
+	LineColor  *LineColor `json:"line_color,omitempty"`  // 默认是{"r":0,"g":0,"b":0} 。auto_color 为 false 时生效
+	IsHyaline  bool       `json:"is_hyaline,omitempty"`  // 默认是false，是否需要透明底色
+}
+
+type WxaQrCodeRequest struct {
+	Path  string `json:"path"`            // 扫码进入的小程序页面路径，最大长度 128 字节，可以携带参数
+	Width int    `json:"width,omitempty"` // 默认430，二维码的宽度，单位 px，最小 280px，最大 1280px
 }
 
 type PushTemplateConfig struct {
@@ -161,8 +206,117 @@ type GetUserPhoneNumberResponse struct {
 }
 
 type JsSDKConfigResponse struct {
-	AppId     string `json:"appId"`
-	Timestamp string `json:"timestamp"`
-	NonceStr  string `json:"nonceStr"`
-	Signature string `json:"signature"`
+	Debug       bool     `json:"debug"`                 // 开启调试模式
+	AppId       string   `json:"appId"`                 // 公众号的唯一标识
+	Timestamp   string   `json:"timestamp"`             // 生成签名的时间戳
+	NonceStr    string   `json:"nonceStr"`              // 生成签名的随机串
+	Signature   string   `json:"signature"`             // 签名
+	JsApiList   []string `json:"jsApiList"`             // 需要使用的 JS 接口列表
+	OpenTagList []string `json:"openTagList,omitempty"` // 需要使用的开放标签列表
+}
+
+type CardExtRequest struct {
+	Code                string // 指定的卡券 code 码，自定义 code 的卡券必填
+	OpenID              string // 指定领取者的 openid，只有该用户能领取
+	FixedBeginTimestamp int64  // 卡券在第三方系统的实际领取时间，固定时长卡券必填
+	OuterStr            string // 领取渠道参数，用于标识本次领取的渠道值
+}
+
+type CardExt struct {
+	Code                string `json:"code,omitempty"`
+	OpenID              string `json:"openid,omitempty"`
+	Timestamp           string `json:"timestamp"`
+	NonceStr            string `json:"nonce_str"`
+	FixedBeginTimestamp int64  `json:"fixed_begintimestamp,omitempty"`
+	OuterStr            string `json:"outer_str,omitempty"`
+	Signature           string `json:"signature"`
+}
+
+type AddCardItem struct {
+	CardId  string `json:"cardId"`  // 卡券 ID
+	CardExt string `json:"cardExt"` // 卡券的扩展参数，为 CardExt 的 JSON 字符串
+}
+
+type ChooseCardRequest struct {
+	ShopID   string // 门店 ID，为空时不限门店
+	CardType string // 卡券类型，如 GROUPON、CASH、DISCOUNT
+	CardID   string // 卡券 ID，为空时不限卡券
+}
+
+type ChooseCardConfig struct {
+	ShopId    string `json:"shopId"`    // 门店 ID
+	CardType  string `json:"cardType"`  // 卡券类型
+	CardId    string `json:"cardId"`    // 卡券 ID
+	Timestamp string `json:"timestamp"` // 生成签名的时间戳
+	NonceStr  string `json:"nonceStr"`  // 生成签名的随机串
+	SignType  string `json:"signType"`  // 签名方式，固定为 SHA1
+	CardSign  string `json:"cardSign"`  // 卡券签名
+}
+
+type APIQuotaResponse struct {
+	ErrResponse
+	Quota              APIQuota     `json:"quota"`                // 当天调用量
+	RateLimit          APIRateLimit `json:"rate_limit"`           // 普通调用频率限制
+	ComponentRateLimit APIRateLimit `json:"component_rate_limit"` // 代调用频率限制
+}
+
+type APIQuota struct {
+	DailyLimit int64 `json:"daily_limit"` // 当天该账号可调用该接口的次数
+	Used       int64 `json:"used"`        // 当天已经调用的次数
+	Remain     int64 `json:"remain"`      // 当天剩余调用次数
+}
+
+type APIRateLimit struct {
+	CallCount     int64 `json:"call_count"`     // 周期内可调用数量，单位：次
+	RefreshSecond int64 `json:"refresh_second"` // 更新周期，单位：秒
+}
+
+type RidInfoResponse struct {
+	ErrResponse
+	Request RidRequestInfo `json:"request"`
+}
+
+type RidRequestInfo struct {
+	InvokeTime   int64  `json:"invoke_time"`   // 发起请求的时间戳
+	CostInMs     int64  `json:"cost_in_ms"`    // 请求毫秒级耗时
+	RequestURL   string `json:"request_url"`   // 请求的 URL 参数
+	RequestBody  string `json:"request_body"`  // POST 请求的请求参数
+	ResponseBody string `json:"response_body"` // 接口请求返回参数
+	ClientIP     string `json:"client_ip"`     // 接口请求的客户端 ip
+}
+
+type APIDomainIPResponse struct {
+	ErrResponse
+	IPList []string `json:"ip_list"` // 微信服务器 IP 地址列表
+}
+
+// Actions and operators of /cgi-bin/callback/check.
+const (
+	CallbackCheckActionAll  = "all"  // 同时检测域名解析和 ping
+	CallbackCheckActionDNS  = "dns"  // 只检测域名解析
+	CallbackCheckActionPing = "ping" // 只检测 ping
+
+	CallbackCheckOperatorDefault  = "DEFAULT"  // 根据 IP 自动选择运营商
+	CallbackCheckOperatorChinaNet = "CHINANET" // 电信
+	CallbackCheckOperatorUnicom   = "UNICOM"   // 联通
+	CallbackCheckOperatorCAP      = "CAP"      // 腾讯自建
+)
+
+type CallbackCheckRequest struct {
+	Action        string `json:"action"`         // 检测动作，all、dns 或 ping
+	CheckOperator string `json:"check_operator"` // 检测的运营商，CHINANET、UNICOM、CAP 或 DEFAULT
+}
+
+type CallbackCheckResponse struct {
+	ErrResponse
+	DNS []struct {
+		IP           string `json:"ip"`            // 解析出来的 IP
+		RealOperator string `json:"real_operator"` // IP 对应的运营商
+	} `json:"dns"`
+	Ping []struct {
+		IP           string `json:"ip"`            // ping 的 IP，执行命令为 ping ip –c 1 -w 1 -q
+		FromOperator string `json:"from_operator"` // ping 的源头的运营商，由请求中的 check_operator 控制
+		PackageLoss  string `json:"package_loss"`  // ping 的丢包率，0% 表示无丢包，100% 表示全部丢包
+		Time         string `json:"time"`          // ping 的耗时，取 ping 结果的 avg 耗时
+	} `json:"ping"`
 }
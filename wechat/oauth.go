@@ -0,0 +1,200 @@
+package wechat
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultAuthorizeURL is the page that asks the user to authorize a web application.
+const DefaultAuthorizeURL = "https://open.weixin.qq.com/connect/oauth2/authorize"
+
+// Scopes of the web OAuth2 authorization.
+const (
+	// ScopeSnsapiBase silently obtains the openid of the user.
+	ScopeSnsapiBase = "snsapi_base"
+	// ScopeSnsapiUserinfo asks the user for the profile returned by GetSnsUserInfo.
+	ScopeSnsapiUserinfo = "snsapi_userinfo"
+)
+
+// Languages of the profile returned by GetSnsUserInfo.
+const (
+	LangZhCN = "zh_CN" // 简体中文
+	LangZhTW = "zh_TW" // 繁体中文
+	LangEn   = "en"    // 英文
+)
+
+// DefaultOAuthStateMaxAge is how long a state created by NewOAuthState stays valid.
+const DefaultOAuthStateMaxAge = 10 * time.Minute
+
+var (
+	ErrorInvalidOAuthState = errors.New("invalid oauth state")
+	ErrorNoOAuthStateKey   = errors.New("no oauth state key configured")
+)
+
+// WithOAuthStateKey sets the HMAC key of the states created by NewOAuthState.
+// The AppSecret is used by default, so the key is required when the AppSecret is not
+// configured, e.g. with WithAccessTokenProvider.
+func WithOAuthStateKey(key []byte) Option {
+	return func(opts *options) {
+		opts.oauthStateKey = key
+	}
+}
+
+// WithOAuthStateMaxAge sets how long a state stays valid, DefaultOAuthStateMaxAge by default.
+func WithOAuthStateMaxAge(maxAge time.Duration) Option {
+	return func(opts *options) {
+		opts.oauthStateMaxAge = maxAge
+	}
+}
+
+type oauthState struct {
+	key    []byte
+	maxAge time.Duration
+}
+
+// AuthorizeURL returns the URL to redirect the user to, in the WeChat browser, to start
+// the web OAuth2 flow. WeChat then redirects to redirectURI with the code to pass to
+// SnsOauth2 and with state unchanged. state should come from NewOAuthState.
+func (w *Wechat) AuthorizeURL(redirectURI, scope, state string) string {
+	// WeChat checks the order of the parameters, so they are not encoded with url.Values
+	return fmt.Sprintf("%s?appid=%s&redirect_uri=%s&response_type=code&scope=%s&state=%s#wechat_redirect",
+		DefaultAuthorizeURL,
+		url.QueryEscape(w.config.AppID),
+		url.QueryEscape(redirectURI),
+		url.QueryEscape(scope),
+		url.QueryEscape(state),
+	)
+}
+
+// NewOAuthState returns a state for AuthorizeURL that is bound to session, such as the
+// ID of the login session of the user, to protect the callback against CSRF. The state is
+// alphanumeric and 88 characters long, within the 128 characters allowed by WeChat.
+// It returns ErrorNoOAuthStateKey if neither a key nor the AppSecret is configured.
+func (w *Wechat) NewOAuthState(session string) (string, error) {
+	if len(w.oauthState.key) == 0 {
+		return "", ErrorNoOAuthStateKey
+	}
+	prefix := fmt.Sprintf("%08x", time.Now().Unix()) + randomBase62(16)
+	return prefix + w.oauthState.sign(prefix, session), nil
+}
+
+// VerifyOAuthState checks that state was created by NewOAuthState for session and has
+// not expired. It returns ErrorInvalidOAuthState otherwise, and ErrorNoOAuthStateKey
+// if neither a key nor the AppSecret is configured.
+func (w *Wechat) VerifyOAuthState(session, state string) error {
+	if len(w.oauthState.key) == 0 {
+		return ErrorNoOAuthStateKey
+	}
+	if len(state) != 88 {
+		return ErrorInvalidOAuthState
+	}
+	prefix, mac := state[:24], state[24:]
+	if !hmac.Equal([]byte(mac), []byte(w.oauthState.sign(prefix, session))) {
+		return ErrorInvalidOAuthState
+	}
+	issued, err := strconv.ParseInt(prefix[:8], 16, 64)
+	if err != nil {
+		return ErrorInvalidOAuthState
+	}
+	if age := time.Since(time.Unix(issued, 0)); age < -time.Minute || age > w.oauthState.maxAge {
+		return ErrorInvalidOAuthState
+	}
+	return nil
+}
+
+func (s oauthState) sign(prefix, session string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(prefix))
+	mac.Write([]byte(session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SnsOauth2 exchanges the code received by the redirect URI for a user access token.
+// The code can only be used once, so the call is never replayed on a backup host.
+func (w *Wechat) SnsOauth2(ctx context.Context, code string) (*SnsOauth2Response, error) {
+	resp, err := w.client.R().
+		Clone(withNoReplay(ctx)).
+		SetHeader("Accept", "application/json").
+		SetQueryParams(map[string]string{
+			"appid":      w.config.AppID,
+			"secret":     w.config.AppSecret,
+			"code":       code,
+			"grant_type": "authorization_code",
+		}).
+		Get("/sns/oauth2/access_token")
+	if err != nil {
+		return nil, err
+	}
+	return loadSuccessResponse(resp, func(a *SnsOauth2Response) error {
+		return checkResponseError(a.ErrCode, a.ErrMsg)
+	})
+}
+
+// RefreshSnsOauth2 renews a user access token with the refresh token returned by SnsOauth2.
+// Refresh tokens are valid for 30 days.
+func (w *Wechat) RefreshSnsOauth2(ctx context.Context, refreshToken string) (*SnsOauth2Response, error) {
+	resp, err := w.client.R().
+		Clone(ctx).
+		SetHeader("Accept", "application/json").
+		SetQueryParams(map[string]string{
+			"appid":         w.config.AppID,
+			"grant_type":    "refresh_token",
+			"refresh_token": refreshToken,
+		}).
+		Get("/sns/oauth2/refresh_token")
+	if err != nil {
+		return nil, err
+	}
+	return loadSuccessResponse(resp, func(a *SnsOauth2Response) error {
+		return checkResponseError(a.ErrCode, a.ErrMsg)
+	})
+}
+
+// GetSnsUserInfo returns the profile of the user, in lang if not empty, with a user access
+// token of scope ScopeSnsapiUserinfo.
+func (w *Wechat) GetSnsUserInfo(ctx context.Context, accessToken, openID, lang string) (*SnsUserInfoResponse, error) {
+	params := map[string]string{
+		"access_token": accessToken,
+		"openid":       openID,
+	}
+	if lang != "" {
+		params["lang"] = lang
+	}
+	resp, err := w.client.R().
+		Clone(ctx).
+		SetHeader("Accept", "application/json").
+		SetQueryParams(params).
+		Get("/sns/userinfo")
+	if err != nil {
+		return nil, err
+	}
+	return loadSuccessResponse(resp, func(a *SnsUserInfoResponse) error {
+		return checkResponseError(a.ErrCode, a.ErrMsg)
+	})
+}
+
+// CheckSnsAccessToken checks that a user access token is still valid for openID.
+func (w *Wechat) CheckSnsAccessToken(ctx context.Context, accessToken, openID string) error {
+	resp, err := w.client.R().
+		Clone(ctx).
+		SetHeader("Accept", "application/json").
+		SetQueryParams(map[string]string{
+			"access_token": accessToken,
+			"openid":       openID,
+		}).
+		Get("/sns/auth")
+	if err != nil {
+		return err
+	}
+	_, err = loadSuccessResponse(resp, func(a *ErrResponse) error {
+		return checkResponseError(a.ErrCode, a.ErrMsg)
+	})
+	return err
+}
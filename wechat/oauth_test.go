@@ -0,0 +1,126 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestWechat_AuthorizeURL(t *testing.T) {
+	wx := NewWechat(Config{AppID: "wx123"}, &nopCache{})
+	got := wx.AuthorizeURL("https://example.com/callback?from=menu", ScopeSnsapiUserinfo, "STATE")
+	want := "https://open.weixin.qq.com/connect/oauth2/authorize?appid=wx123&redirect_uri=https%3A%2F%2Fexample.com%2Fcallback%3Ffrom%3Dmenu&response_type=code&scope=snsapi_userinfo&state=STATE#wechat_redirect"
+	if got != want {
+		t.Errorf("AuthorizeURL =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWechat_OAuthState(t *testing.T) {
+	wx := NewWechat(Config{AppID: "wx123", AppSecret: "secret"}, &nopCache{})
+	state, err := wx.NewOAuthState("session-1")
+	if err != nil {
+		t.Fatalf("NewOAuthState returned error: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9A-Za-z]{1,128}$`).MatchString(state) {
+		t.Fatalf("expected an alphanumeric state of at most 128 characters, got %q", state)
+	}
+	if err := wx.VerifyOAuthState("session-1", state); err != nil {
+		t.Errorf("expected the state to be valid, got %v", err)
+	}
+	if again, _ := wx.NewOAuthState("session-1"); state == again {
+		t.Error("expected a new state on every call")
+	}
+	tampered := state[:30] + "0" + state[31:]
+	if tampered == state {
+		tampered = state[:30] + "1" + state[31:]
+	}
+	for name, tc := range map[string]struct{ session, state string }{
+		"other session": {"session-2", state},
+		"tampered":      {"session-1", tampered},
+		"truncated":     {"session-1", state[:40]},
+	} {
+		if err := wx.VerifyOAuthState(tc.session, tc.state); !errors.Is(err, ErrorInvalidOAuthState) {
+			t.Errorf("%s: expected ErrorInvalidOAuthState, got %v", name, err)
+		}
+	}
+	other := NewWechat(Config{AppID: "wx123", AppSecret: "secret"}, &nopCache{}, WithOAuthStateKey([]byte("other")))
+	if err := other.VerifyOAuthState("session-1", state); !errors.Is(err, ErrorInvalidOAuthState) {
+		t.Errorf("expected a state signed with another key to be rejected, got %v", err)
+	}
+	expired := NewWechat(Config{AppID: "wx123", AppSecret: "secret"}, &nopCache{}, WithOAuthStateMaxAge(-1))
+	if err := expired.VerifyOAuthState("session-1", state); !errors.Is(err, ErrorInvalidOAuthState) {
+		t.Errorf("expected an expired state to be rejected, got %v", err)
+	}
+}
+
+func TestWechat_OAuthState_NoKey(t *testing.T) {
+	provider := AccessTokenProviderFunc(func(ctx context.Context, reload bool) (string, error) {
+		return "token", nil
+	})
+	wx := NewWechat(Config{AppID: "wx123"}, &nopCache{}, WithAccessTokenProvider(provider))
+	_, err := wx.NewOAuthState("session-1")
+	if !errors.Is(err, ErrorNoOAuthStateKey) {
+		t.Errorf("expected ErrorNoOAuthStateKey without AppSecret, got %v", err)
+	}
+	// a state signed with an empty key must not be accepted
+	prefix := fmt.Sprintf("%08x", time.Now().Unix()) + "0123456789abcdef"
+	forged := prefix + oauthState{}.sign(prefix, "")
+	if err := wx.VerifyOAuthState("", forged); !errors.Is(err, ErrorNoOAuthStateKey) {
+		t.Errorf("expected ErrorNoOAuthStateKey without AppSecret, got %v", err)
+	}
+	wx = NewWechat(Config{AppID: "wx123"}, &nopCache{}, WithAccessTokenProvider(provider), WithOAuthStateKey([]byte("key")))
+	state, err := wx.NewOAuthState("session-1")
+	if err != nil {
+		t.Fatalf("NewOAuthState returned error: %v", err)
+	}
+	if err := wx.VerifyOAuthState("session-1", state); err != nil {
+		t.Errorf("expected the state to be valid with an explicit key, got %v", err)
+	}
+}
+
+func TestWechat_SnsOauth2Flow(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	ctx := context.Background()
+	token, err := wx.SnsOauth2(ctx, "code1")
+	if err != nil {
+		t.Fatalf("SnsOauth2 returned error: %v", err)
+	}
+	refreshed, err := wx.RefreshSnsOauth2(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshSnsOauth2 returned error: %v", err)
+	}
+	if refreshed.AccessToken == token.AccessToken || refreshed.OpenID != token.OpenID {
+		t.Errorf("unexpected refreshed token %+v", refreshed)
+	}
+	err = wx.CheckSnsAccessToken(ctx, refreshed.AccessToken, refreshed.OpenID)
+	if err != nil {
+		t.Errorf("CheckSnsAccessToken returned error: %v", err)
+	}
+	info, err := wx.GetSnsUserInfo(ctx, refreshed.AccessToken, refreshed.OpenID, LangEn)
+	if err != nil {
+		t.Fatalf("GetSnsUserInfo returned error: %v", err)
+	}
+	if info.OpenID != token.OpenID || info.UnionID != token.UnionID || info.Nickname != "wechattest (en)" {
+		t.Errorf("unexpected user info %+v", info)
+	}
+	if calls := srv.Calls("/sns/userinfo"); calls[0].Query.Get("lang") != LangEn {
+		t.Errorf("expected lang to be sent, got %v", calls[0].Query)
+	}
+
+	srv.FailNext("/sns/oauth2/access_token", ErrCodeInvalidCode, "invalid code")
+	_, err = wx.SnsOauth2(ctx, "code1")
+	if !errors.Is(err, ErrorInvalidCode) {
+		t.Errorf("expected ErrorInvalidCode, got %v", err)
+	}
+	_, err = wx.RefreshSnsOauth2(ctx, "bogus")
+	if !errors.Is(err, ErrorInvalidRefreshToken) {
+		t.Errorf("expected ErrorInvalidRefreshToken, got %v", err)
+	}
+	err = wx.CheckSnsAccessToken(ctx, "bogus", token.OpenID)
+	if ErrCodeOf(err) != ErrCodeInvalidCredential {
+		t.Errorf("expected errcode 40001 for an invalid token, got %v", err)
+	}
+}
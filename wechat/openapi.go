@@ -0,0 +1,88 @@
+package wechat
+
+import "context"
+
+// GetAPIQuota returns today's usage and the rate limit of an API, such as "/cgi-bin/message/custom/send".
+func (w *Wechat) GetAPIQuota(ctx context.Context, cgiPath string, options ...RequestOption) (*APIQuotaResponse, error) {
+	return withAccessToken(ctx, w, func(ctx context.Context, accessToken string) (*APIQuotaResponse, error) {
+		resp, err := w.client.R().
+			Clone(ctx).
+			SetQueryParams(map[string]string{
+				"access_token": accessToken,
+			}).
+			SetBody(map[string]string{"cgi_path": cgiPath}).
+			Post("/cgi-bin/openapi/quota/get")
+		if err != nil {
+			return nil, err
+		}
+		return loadSuccessResponse(resp, func(a *APIQuotaResponse) error {
+			return checkResponseError(a.ErrCode, a.ErrMsg)
+		})
+	}, options...)
+}
+
+// ClearQuota resets the call counts of every API of the app. WeChat allows it 10 times a month.
+// Local daily counters kept for WithEndpointLimit are reset as well.
+func (w *Wechat) ClearQuota(ctx context.Context, options ...RequestOption) error {
+	_, err := withAccessToken(ctx, w, func(ctx context.Context, accessToken string) (*ErrResponse, error) {
+		resp, err := w.client.R().
+			Clone(ctx).
+			SetQueryParams(map[string]string{
+				"access_token": accessToken,
+			}).
+			SetBody(map[string]string{"appid": w.config.AppID}).
+			Post("/cgi-bin/clear_quota")
+		if err != nil {
+			return nil, err
+		}
+		return loadSuccessResponse(resp, func(a *ErrResponse) error {
+			return checkResponseError(a.ErrCode, a.ErrMsg)
+		})
+	}, append([]RequestOption{withNonIdempotent()}, options...)...)
+	if err != nil {
+		return err
+	}
+	return w.resetQuotaCounters(ctx)
+}
+
+// ClearQuotaWithSecret is like ClearQuota but authenticates with the AppSecret instead of an
+// access token, so it also works when /cgi-bin/token itself has run out of quota.
+func (w *Wechat) ClearQuotaWithSecret(ctx context.Context) error {
+	resp, err := w.client.R().
+		Clone(withNoReplay(ctx)).
+		SetFormData(map[string]string{
+			"appid":     w.config.AppID,
+			"appsecret": w.config.AppSecret,
+		}).
+		Post("/cgi-bin/clear_quota/v2")
+	if err != nil {
+		return err
+	}
+	_, err = loadSuccessResponse(resp, func(a *ErrResponse) error {
+		return checkResponseError(a.ErrCode, a.ErrMsg)
+	})
+	if err != nil {
+		return err
+	}
+	return w.resetQuotaCounters(ctx)
+}
+
+// GetRidInfo looks up the request and response of a failed call from the rid WeChat
+// appended to its errmsg, available as ErrResponse.Rid.
+func (w *Wechat) GetRidInfo(ctx context.Context, rid string, options ...RequestOption) (*RidInfoResponse, error) {
+	return withAccessToken(ctx, w, func(ctx context.Context, accessToken string) (*RidInfoResponse, error) {
+		resp, err := w.client.R().
+			Clone(ctx).
+			SetQueryParams(map[string]string{
+				"access_token": accessToken,
+			}).
+			SetBody(map[string]string{"rid": rid}).
+			Post("/cgi-bin/openapi/rid/get")
+		if err != nil {
+			return nil, err
+		}
+		return loadSuccessResponse(resp, func(a *RidInfoResponse) error {
+			return checkResponseError(a.ErrCode, a.ErrMsg)
+		})
+	}, options...)
+}
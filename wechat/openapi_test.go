@@ -0,0 +1,91 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWechat_GetAPIQuota(t *testing.T) {
+	wx, _ := newTestWechat(t, NewMemoryCache(0))
+	ctx := context.Background()
+	for range 2 {
+		_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+		if err != nil {
+			t.Fatalf("GetQrCode returned error: %v", err)
+		}
+	}
+	quota, err := wx.GetAPIQuota(ctx, "/wxa/getwxacodeunlimit")
+	if err != nil {
+		t.Fatalf("GetAPIQuota returned error: %v", err)
+	}
+	if quota.Quota.Used != 2 || quota.Quota.Remain != quota.Quota.DailyLimit-2 || quota.RateLimit.RefreshSecond == 0 {
+		t.Errorf("unexpected quota %+v", quota)
+	}
+
+	err = wx.ClearQuota(ctx)
+	if err != nil {
+		t.Fatalf("ClearQuota returned error: %v", err)
+	}
+	quota, err = wx.GetAPIQuota(ctx, "/wxa/getwxacodeunlimit")
+	if err != nil {
+		t.Fatalf("GetAPIQuota returned error: %v", err)
+	}
+	if quota.Quota.Used != 0 {
+		t.Errorf("expected usage to be cleared, got %d", quota.Quota.Used)
+	}
+}
+
+func TestWechat_ClearQuotaWithSecret(t *testing.T) {
+	wx, srv := newTestWechat(t, NewMemoryCache(0), WithEndpointLimit("/wxa/getwxacodeunlimit", EndpointLimit{DailyQuota: 1}))
+	ctx := context.Background()
+	_, _ = wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if !IsQuotaExceeded(err) {
+		t.Fatalf("expected local quota error, got %v", err)
+	}
+	err = wx.ClearQuotaWithSecret(ctx)
+	if err != nil {
+		t.Fatalf("ClearQuotaWithSecret returned error: %v", err)
+	}
+	if n := len(srv.Calls("/cgi-bin/token")); n != 1 {
+		t.Errorf("expected no extra token call, got %d", n)
+	}
+	_, err = wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if err != nil {
+		t.Errorf("expected local counters to be reset, got %v", err)
+	}
+
+	srv.AppSecret = "rotated"
+	err = wx.ClearQuotaWithSecret(ctx)
+	if !errors.Is(err, ErrorInvalidAppSecret) {
+		t.Errorf("expected ErrorInvalidAppSecret, got %v", err)
+	}
+}
+
+func TestWechat_GetRidInfo(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	ctx := context.Background()
+	srv.FailNext("/wxa/getwxacodeunlimit", ErrCodeInvalidPage, "invalid page rid: 6523d1a2-5f6e7d8c-1a2b3c4d")
+	_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1", Page: "pages/missing"})
+	var errResp ErrResponse
+	if !errors.As(err, &errResp) || errResp.Rid == "" {
+		t.Fatalf("expected ErrResponse with rid, got %v", err)
+	}
+	info, err := wx.GetRidInfo(ctx, errResp.Rid)
+	if err != nil {
+		t.Fatalf("GetRidInfo returned error: %v", err)
+	}
+	if !strings.Contains(info.Request.RequestBody, "pages/missing") || !strings.Contains(info.Request.ResponseBody, "41030") {
+		t.Errorf("unexpected request info %+v", info.Request)
+	}
+	if strings.Contains(info.Request.RequestURL, "access_token") {
+		t.Errorf("request url leaks the access token: %q", info.Request.RequestURL)
+	}
+
+	_, err = wx.GetRidInfo(ctx, "unknown")
+	if !errors.Is(err, ErrorRidNotFound) {
+		t.Errorf("expected ErrorRidNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"resty.dev/v3"
+)
+
+var ErrorRateLimited = errors.New("rate limit exceeded")
+
+// Counter is an optional interface of Cache for atomic counters. Caches shared between
+// replicas, such as Redis, should implement it so that daily quota accounting stays exact;
+// otherwise counters are updated with Get and SetWithTTL under a process-local lock.
+type Counter interface {
+	// IncrWithTTL adds delta to the integer stored under key and returns the new value.
+	// A missing key counts as 0 and is created with ttl; the ttl of an existing key is kept.
+	IncrWithTTL(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+}
+
+// EndpointLimit limits the calls made to one API path, such as "/wxa/getwxacodeunlimit".
+type EndpointLimit struct {
+	Rate       float64 // 每秒允许的调用次数，0 表示不限速
+	Burst      int     // 令牌桶容量，小于 1 时按 1 处理
+	DailyQuota int64   // 每日调用次数上限，达到后直接返回错误而不再请求，0 表示不计数
+	WarnRatio  float64 // 当日用量达到 DailyQuota 的该比例时触发 QuotaWarningFunc，0 表示不告警
+}
+
+// QuotaUsage is the daily usage of an endpoint. Days follow Beijing time, when WeChat resets quotas.
+type QuotaUsage struct {
+	Endpoint string // 接口路径
+	Day      string // 日期，格式 20060102
+	Used     int64  // 当日已调用次数
+	Limit    int64  // 每日调用次数上限
+}
+
+// QuotaWarningFunc is called when the usage of an endpoint reaches its WarnRatio and again
+// when it reaches its DailyQuota.
+type QuotaWarningFunc = func(ctx context.Context, usage QuotaUsage)
+
+// WithEndpointLimit limits the calls made to endpoint with a token bucket and a daily quota.
+// Calls wait for a token while the context allows it and fail with ErrorRateLimited otherwise.
+// Daily counters are stored in the Cache, so replicas sharing the Cache share the quota.
+func WithEndpointLimit(endpoint string, limit EndpointLimit) Option {
+	return func(opts *options) {
+		if opts.limits == nil {
+			opts.limits = make(map[string]EndpointLimit)
+		}
+		opts.limits[endpoint] = limit
+	}
+}
+
+// WithQuotaWarning sets the hook called when daily usage crosses the warning threshold.
+func WithQuotaWarning(fn QuotaWarningFunc) Option {
+	return func(opts *options) {
+		opts.quotaWarning = fn
+	}
+}
+
+// beijing is the time zone in which WeChat resets daily quotas.
+var beijing = time.FixedZone("CST", 8*60*60)
+
+type endpointLimiter struct {
+	limit  EndpointLimit
+	bucket *tokenBucket
+}
+
+type quotaLimiter struct {
+	mu        sync.Mutex // serializes counters of caches that are not a Counter
+	endpoints map[string]*endpointLimiter
+	warning   QuotaWarningFunc
+}
+
+func newQuotaLimiter(limits map[string]EndpointLimit, warning QuotaWarningFunc) *quotaLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+	q := &quotaLimiter{
+		endpoints: make(map[string]*endpointLimiter, len(limits)),
+		warning:   warning,
+	}
+	for endpoint, limit := range limits {
+		l := &endpointLimiter{limit: limit}
+		if limit.Rate > 0 {
+			l.bucket = newTokenBucket(limit.Rate, limit.Burst)
+		}
+		q.endpoints[endpoint] = l
+	}
+	return q
+}
+
+// quotaKey returns the cache key of the counter of endpoint on day.
+func (w *Wechat) quotaKey(endpoint, day string) string {
+	return w.keys.key("quota:" + day + ":" + endpoint)
+}
+
+// limitRequest is a resty request middleware that applies the endpoint limits before
+// every attempt, including retries, since WeChat counts each of them.
+func (w *Wechat) limitRequest(_ *resty.Client, r *resty.Request) error {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil
+	}
+	l, ok := w.quota.endpoints[u.Path]
+	if !ok {
+		return nil
+	}
+	ctx := r.Context()
+	if l.bucket != nil {
+		err = l.bucket.wait(ctx)
+		if err != nil {
+			return fmt.Errorf("wechat %s: %w", u.Path, err)
+		}
+	}
+	if l.limit.DailyQuota <= 0 {
+		return nil
+	}
+	now := time.Now()
+	usage := QuotaUsage{Endpoint: u.Path, Day: now.In(beijing).Format("20060102"), Limit: l.limit.DailyQuota}
+	key := w.quotaKey(u.Path, usage.Day)
+	usage.Used, err = w.incrCounter(ctx, key, 1, untilNextDay(now))
+	if err != nil {
+		return err
+	}
+	if usage.Used > usage.Limit {
+		_, _ = w.incrCounter(ctx, key, -1, untilNextDay(now)) // the rejected call is not sent, so it does not count
+		return fmt.Errorf("wechat %s: daily quota of %d calls reached: %w", u.Path, usage.Limit, ErrorQuotaExceeded)
+	}
+	if w.quota.warning != nil && (crossed(usage.Used, usage.Limit) || crossed(usage.Used, warnThreshold(l.limit))) {
+		w.quota.warning(ctx, usage)
+	}
+	return nil
+}
+
+// markQuotaExhausted makes later calls short-circuit when WeChat itself reports errcode 45009
+// for a limited endpoint, for example because another system shares the AppID.
+func (w *Wechat) markQuotaExhausted(ctx context.Context, err error) {
+	var e ErrResponse
+	if w.quota == nil || !errors.As(err, &e) || e.ErrCode != ErrCodeQuotaExceeded {
+		return
+	}
+	l, ok := w.quota.endpoints[e.Endpoint]
+	if !ok || l.limit.DailyQuota <= 0 {
+		return
+	}
+	now := time.Now()
+	key := w.quotaKey(e.Endpoint, now.In(beijing).Format("20060102"))
+	_ = w.cache.SetWithTTL(ctx, key, strconv.FormatInt(l.limit.DailyQuota, 10), untilNextDay(now))
+}
+
+// resetQuotaCounters zeroes today's counters of every endpoint with a daily quota.
+func (w *Wechat) resetQuotaCounters(ctx context.Context) error {
+	if w.quota == nil {
+		return nil
+	}
+	now := time.Now()
+	day := now.In(beijing).Format("20060102")
+	for endpoint, l := range w.quota.endpoints {
+		if l.limit.DailyQuota <= 0 {
+			continue
+		}
+		err := w.cache.SetWithTTL(ctx, w.quotaKey(endpoint, day), "0", untilNextDay(now))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QuotaUsage returns today's usage of an endpoint configured with WithEndpointLimit.
+func (w *Wechat) QuotaUsage(ctx context.Context, endpoint string) (QuotaUsage, error) {
+	usage := QuotaUsage{Endpoint: endpoint, Day: time.Now().In(beijing).Format("20060102")}
+	if w.quota != nil {
+		if l, ok := w.quota.endpoints[endpoint]; ok {
+			usage.Limit = l.limit.DailyQuota
+		}
+	}
+	value, exist, err := w.cache.Get(ctx, w.quotaKey(endpoint, usage.Day))
+	if err != nil || !exist {
+		return usage, err
+	}
+	usage.Used, err = strconv.ParseInt(value, 10, 64)
+	return usage, err
+}
+
+// crossed reports whether the increment of a counter to used reached threshold.
+func crossed(used, threshold int64) bool {
+	return used-1 < threshold && used >= threshold
+}
+
+func (w *Wechat) incrCounter(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if counter, ok := w.cache.(Counter); ok {
+		return counter.IncrWithTTL(ctx, key, delta, ttl)
+	}
+	w.quota.mu.Lock()
+	defer w.quota.mu.Unlock()
+	return incrWithCache(ctx, w.cache, key, delta, ttl)
+}
+
+// incrWithCache implements IncrWithTTL on top of Get and SetWithTTL. It is not atomic.
+func incrWithCache(ctx context.Context, cache Cache, key string, delta int64, ttl time.Duration) (int64, error) {
+	value, exist, err := cache.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if exist {
+		n, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n += delta
+	return n, cache.SetWithTTL(ctx, key, strconv.FormatInt(n, 10), ttl)
+}
+
+func warnThreshold(limit EndpointLimit) int64 {
+	if limit.WarnRatio <= 0 {
+		return -1
+	}
+	return max(1, int64(math.Ceil(float64(limit.DailyQuota)*limit.WarnRatio)))
+}
+
+// untilNextDay returns the time left until the next Beijing midnight, plus an hour of slack
+// for clock skew between replicas.
+func untilNextDay(now time.Time) time.Duration {
+	local := now.In(beijing)
+	midnight := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, beijing)
+	return midnight.Sub(now) + time.Hour
+}
+
+// tokenBucket is a token bucket refilled at rate tokens per second up to burst tokens.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := float64(max(burst, 1))
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// reserve takes a token, possibly going into debt, and returns how long to wait before using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a token taken by reserve that will not be used.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// wait blocks until a token is available. It fails right away with ErrorRateLimited if the
+// wait would outlast the context deadline.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	now := time.Now()
+	delay := b.reserve(now)
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		b.cancel()
+		return ErrorRateLimited
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// plainCache hides the Counter implementation of MemoryCache.
+type plainCache struct {
+	Cache
+}
+
+func TestWechat_EndpointLimit_DailyQuota(t *testing.T) {
+	for name, cache := range map[string]Cache{
+		"Counter": NewMemoryCache(0),
+		"Cache":   plainCache{NewMemoryCache(0)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var warnings []QuotaUsage
+			wx, srv := newTestWechat(t, cache,
+				WithEndpointLimit("/wxa/getwxacodeunlimit", EndpointLimit{DailyQuota: 3, WarnRatio: 0.5}),
+				WithQuotaWarning(func(ctx context.Context, usage QuotaUsage) {
+					mu.Lock()
+					defer mu.Unlock()
+					warnings = append(warnings, usage)
+				}),
+			)
+			ctx := context.Background()
+			for i := range 3 {
+				_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+				if err != nil {
+					t.Fatalf("call %d: unexpected error %v", i+1, err)
+				}
+			}
+			for range 2 {
+				_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+				if !IsQuotaExceeded(err) || !errors.Is(err, ErrorQuotaExceeded) {
+					t.Fatalf("expected local quota error, got %v", err)
+				}
+			}
+			if n := len(srv.Calls("/wxa/getwxacodeunlimit")); n != 3 {
+				t.Errorf("expected 3 calls to reach the server, got %d", n)
+			}
+			if len(warnings) != 2 || warnings[0].Used != 2 || warnings[1].Used != 3 || warnings[1].Limit != 3 {
+				t.Errorf("unexpected warnings %+v", warnings)
+			}
+			usage, err := wx.QuotaUsage(ctx, "/wxa/getwxacodeunlimit")
+			if err != nil {
+				t.Fatalf("QuotaUsage returned error: %v", err)
+			}
+			if usage.Used != 3 || usage.Limit != 3 || usage.Day != time.Now().In(beijing).Format("20060102") {
+				t.Errorf("unexpected usage %+v", usage)
+			}
+		})
+	}
+}
+
+func TestWechat_EndpointLimit_RemoteQuotaExceeded(t *testing.T) {
+	wx, srv := newTestWechat(t, NewMemoryCache(0), WithEndpointLimit("/wxa/getwxacodeunlimit", EndpointLimit{DailyQuota: 100}))
+	srv.FailNext("/wxa/getwxacodeunlimit", ErrCodeQuotaExceeded, "reach max api daily quota limit")
+	ctx := context.Background()
+	_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if !IsQuotaExceeded(err) {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	_, err = wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if !IsQuotaExceeded(err) {
+		t.Fatalf("expected short-circuited quota error, got %v", err)
+	}
+	if n := len(srv.Calls("/wxa/getwxacodeunlimit")); n != 1 {
+		t.Errorf("expected 1 call to reach the server, got %d", n)
+	}
+}
+
+func TestWechat_EndpointLimit_Rate(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{}, WithEndpointLimit("/wxa/getwxacodeunlimit", EndpointLimit{Rate: 20, Burst: 1}))
+	ctx := context.Background()
+	start := time.Now()
+	for range 3 {
+		_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected calls to be spaced by the rate limit, took %v", elapsed)
+	}
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := wx.GetQrCode(short, &QrCodeRequest{Scene: "a=1"})
+	if !errors.Is(err, ErrorRateLimited) {
+		t.Fatalf("expected ErrorRateLimited, got %v", err)
+	}
+	if n := len(srv.Calls("/wxa/getwxacodeunlimit")); n != 3 {
+		t.Errorf("expected 3 calls to reach the server, got %d", n)
+	}
+}
+
+func TestUntilNextDay(t *testing.T) {
+	now := time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC) // 23:30 in Beijing
+	if got := untilNextDay(now); got != 90*time.Minute {
+		t.Errorf("expected 1h30m, got %v", got)
+	}
+}
@@ -0,0 +1,103 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"resty.dev/v3"
+)
+
+// GetJSON calls a GET endpoint that is not wrapped by this package, such as one WeChat
+// has just released, and decodes the JSON response into T. The access token is added to
+// query and refreshed like for any other call, a non-zero errcode is returned as an
+// ErrResponse, and the retry policy, limits and middlewares apply.
+func GetJSON[T any](ctx context.Context, w *Wechat, path string, query map[string]string, options ...RequestOption) (*T, error) {
+	return callJSON[T](ctx, w, http.MethodGet, path, query, nil, options...)
+}
+
+// PostJSON is like GetJSON for POST endpoints taking a JSON body. Since a POST may not be
+// idempotent, transient failures are only retried when a policy is passed with WithRequestRetryPolicy.
+func PostJSON[T any](ctx context.Context, w *Wechat, path string, query map[string]string, body any, options ...RequestOption) (*T, error) {
+	return callJSON[T](ctx, w, http.MethodPost, path, query, body, append([]RequestOption{withNonIdempotent()}, options...)...)
+}
+
+// Download calls an endpoint that returns binary content, such as an image or a media file,
+// and returns it. As WeChat answers errors with a JSON body and HTTP 200, a JSON response
+// with a non-zero errcode is returned as an ErrResponse. The request is a POST with a JSON
+// body if body is not nil and a GET otherwise; POSTs are only retried on transient failures
+// when a policy is passed with WithRequestRetryPolicy.
+func (w *Wechat) Download(ctx context.Context, path string, query map[string]string, body any, options ...RequestOption) ([]byte, error) {
+	if body != nil {
+		options = append([]RequestOption{withNonIdempotent()}, options...)
+	}
+	return w.download(ctx, path, query, body, options...)
+}
+
+func callJSON[T any](ctx context.Context, w *Wechat, method, path string, query map[string]string, body any, options ...RequestOption) (*T, error) {
+	return withAccessToken(ctx, w, func(ctx context.Context, accessToken string) (*T, error) {
+		resp, err := w.newRawRequest(ctx, accessToken, query, body).Execute(method, path)
+		if err != nil {
+			return nil, err
+		}
+		return loadSuccessResponse(resp, func(a *T) error {
+			var errResp ErrResponse
+			err := json.Unmarshal(resp.Bytes(), &errResp)
+			if err != nil {
+				return nil // T decoded already, so this is a JSON array or scalar without errcode
+			}
+			return checkResponseError(errResp.ErrCode, errResp.ErrMsg)
+		})
+	}, options...)
+}
+
+type downloadResult struct {
+	raw []byte
+}
+
+func (w *Wechat) download(ctx context.Context, path string, query map[string]string, body any, options ...RequestOption) ([]byte, error) {
+	method := http.MethodGet
+	if body != nil {
+		method = http.MethodPost
+	}
+	result, err := withAccessToken(ctx, w, func(ctx context.Context, accessToken string) (*downloadResult, error) {
+		resp, err := w.newRawRequest(ctx, accessToken, query, body).Execute(method, path)
+		if err != nil {
+			return nil, err
+		}
+		res := resp.Bytes()
+		// 接口出错时同样返回 200，但 Content-Type 为 JSON
+		if resp.StatusCode() == http.StatusOK && !strings.Contains(resp.Header().Get("Content-Type"), "json") {
+			return &downloadResult{raw: res}, nil
+		}
+		var errResp ErrResponse
+		err = json.Unmarshal(res, &errResp)
+		if resp.IsError() && (err != nil || errResp.ErrCode == 0) {
+			return nil, newHTTPError(resp)
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = checkResponseError(errResp.ErrCode, errResp.ErrMsg)
+		if err != nil {
+			return nil, withResponse(err, resp)
+		}
+		return &downloadResult{raw: res}, nil // a JSON document without errcode is the content itself
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+	return result.raw, nil
+}
+
+func (w *Wechat) newRawRequest(ctx context.Context, accessToken string, query map[string]string, body any) *resty.Request {
+	req := w.client.R().
+		Clone(ctx).
+		SetQueryParams(query).
+		SetQueryParam("access_token", accessToken)
+	if body != nil {
+		req = req.SetBody(body)
+	}
+	return req
+}
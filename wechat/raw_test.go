@@ -0,0 +1,97 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+)
+
+type rawResult struct {
+	Echo  string `json:"echo"`
+	Items []int  `json:"items"`
+}
+
+func TestGetJSON(t *testing.T) {
+	rec := &recordingMiddleware{}
+	wx, srv := newTestWechat(t, NewMemoryCache(0), WithMiddleware(rec))
+	srv.HandleWithAccessToken("/wxa/new_api", func(rw http.ResponseWriter, r *http.Request) {
+		wechattest.WriteJSON(rw, http.StatusOK, map[string]any{"errcode": 0, "errmsg": "ok", "echo": r.URL.Query().Get("q"), "items": []int{1, 2}})
+	})
+	ctx := context.Background()
+	_, err := wx.GetAccessToken(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get access token: %v", err)
+	}
+	srv.ExpireTokens()
+	result, err := GetJSON[rawResult](ctx, wx, "/wxa/new_api", map[string]string{"q": "hello"})
+	if err != nil {
+		t.Fatalf("GetJSON returned error: %v", err)
+	}
+	if result.Echo != "hello" || len(result.Items) != 2 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if n := len(srv.Calls("/wxa/new_api")); n != 2 {
+		t.Errorf("expected the expired token to be refreshed and the call repeated, got %d calls", n)
+	}
+	if last := rec.calls[len(rec.calls)-1]; last.Endpoint != "/wxa/new_api" || last.Query.Get("access_token") != "REDACTED" {
+		t.Errorf("expected middlewares to see the call, got %+v", last)
+	}
+
+	srv.FailNext("/wxa/new_api", ErrCodeAPIUnauthorized, "api unauthorized")
+	_, err = GetJSON[rawResult](ctx, wx, "/wxa/new_api", nil)
+	var errResp ErrResponse
+	if !errors.As(err, &errResp) || errResp.ErrCode != ErrCodeAPIUnauthorized || errResp.Endpoint != "/wxa/new_api" {
+		t.Errorf("expected ErrResponse 48001 for /wxa/new_api, got %v", err)
+	}
+}
+
+func TestPostJSON(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{}, WithRetryPolicy(testRetryPolicy))
+	srv.HandleWithAccessToken("/wxa/new_api", func(rw http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Echo string `json:"echo"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		wechattest.WriteJSON(rw, http.StatusOK, map[string]any{"echo": req.Echo})
+	})
+	ctx := context.Background()
+	srv.FailNext("/wxa/new_api", ErrCodeSystemBusy, "system error")
+	_, err := PostJSON[rawResult](ctx, wx, "/wxa/new_api", nil, map[string]string{"echo": "hi"})
+	if !errors.Is(err, ErrorSystemBusy) {
+		t.Fatalf("expected POST not to be retried by default, got %v", err)
+	}
+	srv.FailNext("/wxa/new_api", ErrCodeSystemBusy, "system error")
+	result, err := PostJSON[rawResult](ctx, wx, "/wxa/new_api", nil, map[string]string{"echo": "hi"}, WithRequestRetryPolicy(testRetryPolicy))
+	if err != nil {
+		t.Fatalf("expected explicit policy to retry, got %v", err)
+	}
+	if result.Echo != "hi" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestWechat_Download(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	srv.HandleWithAccessToken("/cgi-bin/media/get", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "image/jpeg")
+		_, _ = rw.Write([]byte("media-" + r.URL.Query().Get("media_id")))
+	})
+	ctx := context.Background()
+	raw, err := wx.Download(ctx, "/cgi-bin/media/get", map[string]string{"media_id": "m1"}, nil)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	if !bytes.Equal(raw, []byte("media-m1")) {
+		t.Errorf("unexpected content %q", raw)
+	}
+	srv.FailNext("/cgi-bin/media/get", 40007, "invalid media_id")
+	_, err = wx.Download(ctx, "/cgi-bin/media/get", map[string]string{"media_id": "missing"}, nil)
+	if ErrCodeOf(err) != 40007 {
+		t.Errorf("expected errcode 40007, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package wechat
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const minRefreshInterval = 100 * time.Millisecond
+
+type refresherOptions struct {
+	fraction   float64
+	jsTicket   bool
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func newRefresherOptions(opts ...RefresherOption) *refresherOptions {
+	defaults := &refresherOptions{
+		fraction:   0.8,
+		jsTicket:   false,
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(defaults)
+	}
+	return defaults
+}
+
+type RefresherOption = func(*refresherOptions)
+
+// WithRefreshFraction sets the fraction of a token's lifetime after which it is renewed.
+// Values outside (0, 1) are ignored. The default is 0.8.
+func WithRefreshFraction(fraction float64) RefresherOption {
+	return func(opts *refresherOptions) {
+		if fraction > 0 && fraction < 1 {
+			opts.fraction = fraction
+		}
+	}
+}
+
+// WithRefreshJsTicket also keeps the jsapi ticket fresh.
+func WithRefreshJsTicket(enabled bool) RefresherOption {
+	return func(opts *refresherOptions) {
+		opts.jsTicket = enabled
+	}
+}
+
+// WithRefreshBackoff sets the exponential backoff bounds used after a failed refresh.
+func WithRefreshBackoff(minBackoff, maxBackoff time.Duration) RefresherOption {
+	return func(opts *refresherOptions) {
+		opts.minBackoff = minBackoff
+		opts.maxBackoff = maxBackoff
+	}
+}
+
+// RefreshStatus reports the state of one refreshed token or ticket.
+type RefreshStatus struct {
+	Enabled     bool      // Whether the Refresher manages this value
+	LastRefresh time.Time // Time of the last successful refresh
+	ExpiresAt   time.Time // Expiry of the value obtained by the last successful refresh
+	NextRefresh time.Time // Scheduled time of the next attempt
+	LastError   error     // Error of the last attempt, nil if it succeeded
+	Failures    int       // Consecutive failed attempts
+}
+
+// RefresherStatus is a snapshot of a Refresher.
+type RefresherStatus struct {
+	Running     bool
+	AccessToken RefreshStatus
+	JsTicket    RefreshStatus
+}
+
+// Refresher renews the access token, and optionally the jsapi ticket, in the background
+// before they expire, so that requests never pay the refresh latency.
+// Each refresh goes through the same singleflight, Locker and Cache path as a lazy refresh,
+// and a value that another replica refreshed is reused until its refresh fraction is due.
+// The access token is left alone when the Wechat uses a custom AccessTokenProvider.
+type Refresher struct {
+	w      *Wechat
+	opts   *refresherOptions
+	mu     sync.Mutex
+	status RefresherStatus
+}
+
+func NewRefresher(w *Wechat, options ...RefresherOption) *Refresher {
+	return &Refresher{
+		w:    w,
+		opts: newRefresherOptions(options...),
+	}
+}
+
+// Run refreshes immediately and then keeps refreshing until ctx is cancelled.
+// It always returns ctx.Err().
+func (r *Refresher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	_, ownsToken := r.w.tokens.(*cachedAccessTokenProvider)
+	r.mu.Lock()
+	r.status.Running = true
+	r.status.AccessToken.Enabled = ownsToken
+	r.status.JsTicket.Enabled = r.opts.jsTicket
+	r.mu.Unlock()
+	if ownsToken {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.loop(ctx, &r.status.AccessToken, func(ctx context.Context) (*refreshResult, error) {
+				return r.w.refreshAccessToken(ctx, "", r.notDue, false)
+			})
+		}()
+	}
+	if r.opts.jsTicket {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.loop(ctx, &r.status.JsTicket, func(ctx context.Context) (*refreshResult, error) {
+				return r.w.refreshJsTicket(ctx, r.notDue)
+			})
+		}()
+	}
+	wg.Wait()
+	<-ctx.Done()
+	r.mu.Lock()
+	r.status.Running = false
+	r.mu.Unlock()
+	return ctx.Err()
+}
+
+// Status returns a snapshot of the refresher state.
+func (r *Refresher) Status() RefresherStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+func (r *Refresher) loop(ctx context.Context, status *RefreshStatus, refresh func(ctx context.Context) (*refreshResult, error)) {
+	var delay time.Duration
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		result, err := refresh(ctx)
+		now := time.Now()
+		r.mu.Lock()
+		if err != nil {
+			if ctx.Err() != nil {
+				r.mu.Unlock()
+				return
+			}
+			status.LastError = err
+			status.Failures++
+			delay = r.backoff(status.Failures)
+		} else {
+			status.LastError = nil
+			status.Failures = 0
+			status.LastRefresh = now
+			if !result.issuedAt.IsZero() {
+				status.LastRefresh = result.issuedAt // refreshed earlier, possibly by another replica
+			}
+			status.ExpiresAt = result.expiresAt
+			delay = r.opts.minBackoff // lifetime unknown, check again soon
+			if !result.expiresAt.IsZero() {
+				delay = max(r.dueAt(result).Sub(now), minRefreshInterval)
+			}
+		}
+		status.NextRefresh = now.Add(delay)
+		r.mu.Unlock()
+	}
+}
+
+// dueAt returns when the fraction of the lifetime of a value has elapsed.
+func (r *Refresher) dueAt(result *refreshResult) time.Time {
+	lifetime := result.expiresAt.Sub(result.issuedAt)
+	return result.issuedAt.Add(time.Duration(float64(lifetime) * r.opts.fraction))
+}
+
+// notDue reuses a cached value, which may have been refreshed by another replica, until
+// the refresh fraction of its lifetime has elapsed. Values of unknown lifetime are refreshed.
+func (r *Refresher) notDue(cached *refreshResult) bool {
+	return !cached.expiresAt.IsZero() && time.Now().Before(r.dueAt(cached))
+}
+
+func (r *Refresher) backoff(failures int) time.Duration {
+	delay := r.opts.minBackoff
+	for i := 1; i < failures && delay < r.opts.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.opts.maxBackoff)
+}
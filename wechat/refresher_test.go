@@ -0,0 +1,80 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefresher_Run(t *testing.T) {
+	cache := NewMemoryCache(0)
+	wx, srv := newTestWechat(t, cache)
+	srv.SetExpiresIn(3)
+	srv.FailNext("/cgi-bin/token", -1, "system error")
+
+	refresher := NewRefresher(wx, WithRefreshFraction(0.2), WithRefreshJsTicket(true), WithRefreshBackoff(10*time.Millisecond, 20*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 1200*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- refresher.Run(ctx)
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	status := refresher.Status()
+	if !status.Running || !status.AccessToken.Enabled || !status.JsTicket.Enabled {
+		t.Errorf("unexpected running status: %+v", status)
+	}
+	if status.AccessToken.LastError != nil || status.AccessToken.LastRefresh.IsZero() {
+		t.Errorf("expected access token to recover from the failed attempt: %+v", status.AccessToken)
+	}
+	if token, ok, _ := cache.Get(ctx, "wechat:"+srv.AppID+":access_token"); !ok || token == "" {
+		t.Error("expected refreshed access token in cache")
+	}
+
+	err := <-done
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Run to stop with the context error, got %v", err)
+	}
+	if refresher.Status().Running {
+		t.Error("expected refresher to report stopped")
+	}
+	// one failure, then refreshes at roughly 0s, 0.6s and 1.2s
+	if n := len(srv.Calls("/cgi-bin/token")); n < 3 {
+		t.Errorf("expected at least 3 token calls, got %d", n)
+	}
+	if n := len(srv.Calls("/cgi-bin/ticket/getticket")); n < 2 {
+		t.Errorf("expected at least 2 ticket calls, got %d", n)
+	}
+}
+
+func TestRefresher_SharedCache(t *testing.T) {
+	cache := NewMemoryCache(0)
+	first, srv := newTestWechat(t, cache)
+	config := Config{AppID: srv.AppID, AppSecret: srv.AppSecret}
+	second := NewWechat(config, cache, WithBaseURL(srv.URL))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = NewRefresher(first).Run(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	refresher := NewRefresher(second)
+	go func() {
+		_ = refresher.Run(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if n := len(srv.Calls("/cgi-bin/token")); n != 1 {
+		t.Errorf("expected the second replica to reuse the cached token, got %d token calls", n)
+	}
+	status := refresher.Status().AccessToken
+	if lifetime := status.ExpiresAt.Sub(status.LastRefresh); lifetime != 7200*time.Second {
+		t.Errorf("expected the lifetime stored with the token, got %v", lifetime)
+	}
+	if wait := time.Until(status.NextRefresh); wait < 5000*time.Second {
+		t.Errorf("expected the next refresh at 80%% of the lifetime, got %v", wait)
+	}
+}
@@ -0,0 +1,160 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrorInvalidRegistryConfig = errors.New("invalid registry config")
+
+// AppHealth is the result of a health check of one registered app.
+type AppHealth struct {
+	AppID     string
+	Alias     string
+	Healthy   bool
+	Err       error
+	CheckedAt time.Time
+	Latency   time.Duration
+}
+
+// Registry holds Wechat clients for many mini-programs and official accounts. All clients
+// share one HTTP transport and one Cache, whose keys are namespaced per AppID.
+type Registry struct {
+	cache   Cache
+	client  *http.Client // shared by every app without a proxy
+	options []Option
+	mu      sync.RWMutex
+	apps    map[string]*registryApp // by AppID
+	aliases map[string]string       // alias to AppID
+}
+
+type registryApp struct {
+	config Config
+	client *Wechat
+}
+
+// NewRegistry creates an empty Registry. options are applied to every client after the
+// shared HTTP client, so they can override it. Apps with Config.Proxy set get their own
+// transport, since a proxy is a transport-wide setting.
+func NewRegistry(cache Cache, options ...Option) *Registry {
+	return &Registry{
+		cache:   cache,
+		client:  &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()},
+		options: options,
+		apps:    make(map[string]*registryApp),
+		aliases: make(map[string]string),
+	}
+}
+
+// Load replaces the registered apps with configs. Clients whose Config is unchanged are
+// kept, so their in-flight refreshes are not disturbed; changed apps get a new client and
+// apps missing from configs are removed. On error the registry is left unchanged.
+func (r *Registry) Load(configs []Config) error {
+	apps := make(map[string]*registryApp, len(configs))
+	aliases := make(map[string]string)
+	for _, config := range configs {
+		if config.AppID == "" {
+			return fmt.Errorf("%w: empty app_id", ErrorInvalidRegistryConfig)
+		}
+		if _, ok := apps[config.AppID]; ok {
+			return fmt.Errorf("%w: duplicate app_id %s", ErrorInvalidRegistryConfig, config.AppID)
+		}
+		apps[config.AppID] = &registryApp{config: config}
+		if config.Alias != "" {
+			if _, ok := aliases[config.Alias]; ok {
+				return fmt.Errorf("%w: duplicate alias %s", ErrorInvalidRegistryConfig, config.Alias)
+			}
+			aliases[config.Alias] = config.AppID
+		}
+	}
+	for alias := range aliases {
+		if _, ok := apps[alias]; ok {
+			return fmt.Errorf("%w: alias %s shadows an app_id", ErrorInvalidRegistryConfig, alias)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for appID, app := range apps {
+		if current, ok := r.apps[appID]; ok && current.config == app.config {
+			app.client = current.client
+			continue
+		}
+		app.client = r.newClient(app.config)
+	}
+	r.apps = apps
+	r.aliases = aliases
+	return nil
+}
+
+func (r *Registry) newClient(config Config) *Wechat {
+	if config.Proxy != "" {
+		return NewWechat(config, r.cache, r.options...)
+	}
+	return NewWechat(config, r.cache, append([]Option{WithHTTPClient(r.client)}, r.options...)...)
+}
+
+// Get returns the client registered under an AppID or alias.
+func (r *Registry) Get(appIDOrAlias string) (*Wechat, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if app, ok := r.apps[appIDOrAlias]; ok {
+		return app.client, true
+	}
+	if appID, ok := r.aliases[appIDOrAlias]; ok {
+		return r.apps[appID].client, true
+	}
+	return nil, false
+}
+
+// AppIDs returns the registered AppIDs in sorted order.
+func (r *Registry) AppIDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]string, 0, len(r.apps))
+	for appID := range r.apps {
+		ids = append(ids, appID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Health checks every registered app concurrently by obtaining an access token, which is
+// served from the Cache when one is available. Results are sorted by AppID.
+func (r *Registry) Health(ctx context.Context) []AppHealth {
+	r.mu.RLock()
+	apps := make([]*registryApp, 0, len(r.apps))
+	for _, app := range r.apps {
+		apps = append(apps, app)
+	}
+	r.mu.RUnlock()
+
+	results := make([]AppHealth, len(apps))
+	var wg sync.WaitGroup
+	for i, app := range apps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			_, err := app.client.GetAccessToken(ctx, false)
+			results[i] = AppHealth{
+				AppID:     app.config.AppID,
+				Alias:     app.config.Alias,
+				Healthy:   err == nil,
+				Err:       err,
+				CheckedAt: start,
+				Latency:   time.Since(start),
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].AppID < results[j].AppID
+	})
+	return results
+}
@@ -0,0 +1,68 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+)
+
+func TestRegistry(t *testing.T) {
+	srv := wechattest.NewServer()
+	t.Cleanup(srv.Close)
+	registry := NewRegistry(NewMemoryCache(0), WithBaseURL(srv.URL))
+
+	shop := Config{AppID: srv.AppID, AppSecret: srv.AppSecret, Alias: "shop"}
+	broken := Config{AppID: "wxbroken000000000", AppSecret: "secret", Alias: "broken"}
+	err := registry.Load([]Config{shop, broken})
+	if err != nil {
+		t.Fatalf("failed to load configs: %v", err)
+	}
+	byAlias, ok := registry.Get("shop")
+	if !ok {
+		t.Fatal("expected app to be found by alias")
+	}
+	byAppID, _ := registry.Get(srv.AppID)
+	if byAlias != byAppID {
+		t.Error("expected alias and AppID to resolve to the same client")
+	}
+
+	health := registry.Health(context.Background())
+	if len(health) != 2 {
+		t.Fatalf("expected 2 health results, got %d", len(health))
+	}
+	for _, h := range health {
+		if want := h.AppID == srv.AppID; h.Healthy != want {
+			t.Errorf("unexpected health for %s: %+v", h.AppID, h)
+		}
+	}
+
+	shop.Env = MiniAppEnvTrial
+	err = registry.Load([]Config{shop})
+	if err != nil {
+		t.Fatalf("failed to reload configs: %v", err)
+	}
+	reloaded, _ := registry.Get("shop")
+	if reloaded == byAlias {
+		t.Error("expected changed config to get a new client")
+	}
+	if _, ok := registry.Get("broken"); ok {
+		t.Error("expected removed app to be gone")
+	}
+	err = registry.Load([]Config{shop})
+	if err != nil {
+		t.Fatalf("failed to reload configs: %v", err)
+	}
+	if same, _ := registry.Get("shop"); same != reloaded {
+		t.Error("expected unchanged config to keep its client")
+	}
+
+	err = registry.Load([]Config{shop, {AppID: "wxother", Alias: "shop"}})
+	if !errors.Is(err, ErrorInvalidRegistryConfig) {
+		t.Errorf("expected duplicate alias to be rejected, got %v", err)
+	}
+	if got := registry.AppIDs(); len(got) != 1 || got[0] != srv.AppID {
+		t.Errorf("expected failed load to leave registry unchanged, got %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package wechat
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how calls are repeated after transient failures such as errcode -1,
+// HTTP 5xx responses and network timeouts. Access token errors are handled separately by
+// refreshing the token once, regardless of the policy.
+type RetryPolicy struct {
+	MaxAttempts    int                  // Total attempts including the first one; below 2 disables retries
+	InitialBackoff time.Duration        // Delay before the first retry
+	MaxBackoff     time.Duration        // Upper bound of the delay between attempts
+	Multiplier     float64              // Backoff growth factor per attempt, 2 if not positive
+	Jitter         float64              // Fraction of the delay that is randomized, between 0 and 1
+	Retryable      func(err error) bool // Classifies retryable errors, IsRetryable if nil
+}
+
+var (
+	// DefaultRetryPolicy makes up to 3 attempts with exponential backoff from 200ms to 2s.
+	DefaultRetryPolicy = RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+	// NoRetry disables retries.
+	NoRetry = RetryPolicy{MaxAttempts: 1}
+)
+
+// backoff returns the delay before attempt+1, after attempt attempts have failed.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 {
+		delay = math.Min(delay, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay)
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// retry runs fn until it succeeds, the policy gives up or ctx is done. It does not start
+// a retry whose backoff would end after the context deadline.
+func retry[T any](ctx context.Context, policy RetryPolicy, fn func() (*T, error)) (*T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return nil, err
+		}
+		delay := policy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return nil, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
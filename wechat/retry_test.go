@@ -0,0 +1,109 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+)
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Multiplier: 2}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond} {
+		if got := policy.backoff(attempt + 1); got != want {
+			t.Errorf("attempt %d: expected %v, got %v", attempt+1, want, got)
+		}
+	}
+	policy.Jitter = 0.5
+	for range 100 {
+		if got := policy.backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("jittered backoff out of range: %v", got)
+		}
+	}
+}
+
+func TestWechat_RetryPolicy_Transient(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{}, WithRetryPolicy(testRetryPolicy))
+	srv.FailNext("/wxa/getwxacodeunlimit", ErrCodeSystemBusy, "system error")
+	srv.FailNextWith("/wxa/getwxacodeunlimit", wechattest.Failure{HTTPStatus: http.StatusBadGateway})
+	image, err := wx.GetQrCode(context.Background(), &QrCodeRequest{Scene: "a=1"})
+	if err != nil {
+		t.Fatalf("expected retries to succeed, got %v", err)
+	}
+	if !bytes.Equal(image, wechattest.QrCodeImage) {
+		t.Errorf("unexpected image: %q", image)
+	}
+	if n := len(srv.Calls("/wxa/getwxacodeunlimit")); n != 3 {
+		t.Errorf("expected 3 calls, got %d", n)
+	}
+}
+
+func TestWechat_RetryPolicy_MaxAttempts(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{}, WithRetryPolicy(testRetryPolicy))
+	for range 4 {
+		srv.FailNextWith("/wxa/getwxacodeunlimit", wechattest.Failure{HTTPStatus: http.StatusServiceUnavailable})
+	}
+	_, err := wx.GetQrCode(context.Background(), &QrCodeRequest{Scene: "a=1"})
+	var httpErr HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected HTTPError 503, got %v", err)
+	}
+	if httpErr.Endpoint != "/wxa/getwxacodeunlimit" {
+		t.Errorf("unexpected endpoint %q", httpErr.Endpoint)
+	}
+	if n := len(srv.Calls("/wxa/getwxacodeunlimit")); n != 3 {
+		t.Errorf("expected 3 calls, got %d", n)
+	}
+}
+
+func TestWechat_RetryPolicy_NonRetryable(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{}, WithRetryPolicy(testRetryPolicy))
+	srv.FailNext("/wxa/getwxacodeunlimit", ErrCodeInvalidArgument, "argument invalid")
+	_, err := wx.GetQrCode(context.Background(), &QrCodeRequest{Scene: "a=1"})
+	if !errors.Is(err, ErrorInvalidArgument) {
+		t.Fatalf("expected ErrorInvalidArgument, got %v", err)
+	}
+	if n := len(srv.Calls("/wxa/getwxacodeunlimit")); n != 1 {
+		t.Errorf("expected 1 call, got %d", n)
+	}
+}
+
+func TestWechat_RetryPolicy_SendMessageOptOut(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{}, WithRetryPolicy(testRetryPolicy))
+	msg := &SubscribeMessageRequest{TemplateID: "tpl", ToUser: "openid"}
+	srv.FailNext("/cgi-bin/message/subscribe/send", ErrCodeSystemBusy, "system error")
+	err := wx.SendMessage(context.Background(), msg)
+	if !errors.Is(err, ErrorSystemBusy) {
+		t.Fatalf("expected ErrorSystemBusy, got %v", err)
+	}
+	srv.FailNext("/cgi-bin/message/subscribe/send", ErrCodeSystemBusy, "system error")
+	err = wx.SendMessage(context.Background(), msg, WithRequestRetryPolicy(testRetryPolicy))
+	if err != nil {
+		t.Fatalf("expected explicit policy to retry, got %v", err)
+	}
+	if n := len(srv.Calls("/cgi-bin/message/subscribe/send")); n != 3 {
+		t.Errorf("expected 3 send calls, got %d", n)
+	}
+}
+
+func TestWechat_RetryPolicy_Deadline(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second}
+	wx, srv := newTestWechat(t, &nopCache{}, WithRetryPolicy(policy))
+	srv.FailNext("/wxa/getwxacodeunlimit", ErrCodeSystemBusy, "system error")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if !errors.Is(err, ErrorSystemBusy) {
+		t.Fatalf("expected last error to be returned, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("expected to give up before the deadline, took %v", elapsed)
+	}
+}
@@ -0,0 +1,466 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxPushBodySize = 1 << 20
+
+// DefaultPushTimestampWindow is how far the timestamp of a pushed message or handshake may
+// be from the current time unless changed with WithPushTimestampWindow.
+const DefaultPushTimestampWindow = 5 * time.Minute
+
+var (
+	ErrorInvalidEncodingAESKey = errors.New("invalid encoding aes key")
+	ErrorInvalidSignature      = errors.New("invalid signature")
+	ErrorInvalidReceiver       = errors.New("invalid message receiver")
+	ErrorInvalidTimestamp      = errors.New("invalid or expired timestamp")
+	ErrorPlaintextMessage      = errors.New("plaintext message in safe mode")
+)
+
+const (
+	// MessageFormatXML is the push data format for XML payloads.
+	MessageFormatXML = "xml"
+	// MessageFormatJSON is the push data format for JSON payloads.
+	MessageFormatJSON = "json"
+)
+
+const (
+	MsgTypeText            = "text"
+	MsgTypeImage           = "image"
+	MsgTypeMiniProgramPage = "miniprogrampage"
+	MsgTypeEvent           = "event"
+)
+
+const (
+	EventSubscribeMsgPopup          = "subscribe_msg_popup_event"      // 用户操作订阅通知弹窗
+	EventSubscribeMsgChange         = "subscribe_msg_change_event"     // 用户管理订阅通知
+	EventSubscribeMsgSent           = "subscribe_msg_sent_event"       // 发送订阅通知
+	EventUserEnterTempSession       = "user_enter_tempsession"         // 用户进入客服会话
+	EventTradeManageRemindAccessAPI = "trade_manage_remind_access_api" // 提醒接入发货信息管理服务API
+	EventTradeManageRemindShipping  = "trade_manage_remind_shipping"   // 提醒需要上传发货信息
+	EventTradeManageOrderSettlement = "trade_manage_order_settlement"  // 订单将要结算或已经结算
+)
+
+// MessageHeader holds the fields shared by every pushed message and event.
+type MessageHeader struct {
+	ToUserName   string `xml:"ToUserName" json:"ToUserName"`     // 小程序的原始ID
+	FromUserName string `xml:"FromUserName" json:"FromUserName"` // 发送者的 openid
+	CreateTime   int64  `xml:"CreateTime" json:"CreateTime"`     // 消息创建时间（整型）
+	MsgType      string `xml:"MsgType" json:"MsgType"`           // 消息类型
+	Event        string `xml:"Event" json:"Event"`               // 事件类型，MsgType 为 event 时有效
+}
+
+// Message is a verified and decrypted push payload. Decode unmarshals it into a typed struct.
+type Message struct {
+	MessageHeader
+	Format string // MessageFormatXML or MessageFormatJSON
+	Raw    []byte // plaintext payload
+}
+
+// Decode unmarshals the plaintext payload into v according to the message format.
+func (m *Message) Decode(v any) error {
+	if m.Format == MessageFormatJSON {
+		return json.Unmarshal(m.Raw, v)
+	}
+	return xml.Unmarshal(m.Raw, v)
+}
+
+// EventList is a list field that accepts both a single JSON object and a JSON array,
+// since WeChat uses either shape depending on the event.
+type EventList[T any] []T
+
+func (l *EventList[T]) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var item T
+		err := json.Unmarshal(data, &item)
+		if err != nil {
+			return err
+		}
+		*l = EventList[T]{item}
+		return nil
+	}
+	var items []T
+	err := json.Unmarshal(data, &items)
+	if err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+type SubscribeMsgPopupItem struct {
+	TemplateID            string `xml:"TemplateId" json:"TemplateId"`                       // 模板id
+	SubscribeStatusString string `xml:"SubscribeStatusString" json:"SubscribeStatusString"` // accept、reject 或 ban
+	PopupScene            string `xml:"PopupScene" json:"PopupScene"`                       // 0 小程序页面内，1 支付后，2 公众号文章
+}
+
+type SubscribeMsgPopupEvent struct {
+	MessageHeader
+	List EventList[SubscribeMsgPopupItem] `xml:"SubscribeMsgPopupEvent>List" json:"List"`
+}
+
+type SubscribeMsgChangeItem struct {
+	TemplateID            string `xml:"TemplateId" json:"TemplateId"`                       // 模板id
+	SubscribeStatusString string `xml:"SubscribeStatusString" json:"SubscribeStatusString"` // reject 取消订阅
+}
+
+type SubscribeMsgChangeEvent struct {
+	MessageHeader
+	List EventList[SubscribeMsgChangeItem] `xml:"SubscribeMsgChangeEvent>List" json:"List"`
+}
+
+type SubscribeMsgSentItem struct {
+	TemplateID  string `xml:"TemplateId" json:"TemplateId"`   // 模板id
+	MsgID       string `xml:"MsgID" json:"MsgID"`             // 消息id
+	ErrorCode   int    `xml:"ErrorCode" json:"ErrorCode"`     // 推送结果状态码，0 表示成功
+	ErrorStatus string `xml:"ErrorStatus" json:"ErrorStatus"` // 推送结果状态码对应的含义
+}
+
+type SubscribeMsgSentEvent struct {
+	MessageHeader
+	List EventList[SubscribeMsgSentItem] `xml:"SubscribeMsgSentEvent>List" json:"List"`
+}
+
+// CustomerServiceMessage covers the customer-service message types (text, image,
+// miniprogrampage) and the user_enter_tempsession event.
+type CustomerServiceMessage struct {
+	MessageHeader
+	MsgID        int64  `xml:"MsgId" json:"MsgId"`               // 消息id
+	Content      string `xml:"Content" json:"Content"`           // 文本消息内容
+	PicURL       string `xml:"PicUrl" json:"PicUrl"`             // 图片链接
+	MediaID      string `xml:"MediaId" json:"MediaId"`           // 图片消息媒体id
+	Title        string `xml:"Title" json:"Title"`               // 小程序卡片标题
+	AppID        string `xml:"AppId" json:"AppId"`               // 小程序卡片 appid
+	PagePath     string `xml:"PagePath" json:"PagePath"`         // 小程序卡片页面路径
+	ThumbURL     string `xml:"ThumbUrl" json:"ThumbUrl"`         // 小程序卡片封面图片的临时cdn链接
+	ThumbMediaID string `xml:"ThumbMediaId" json:"ThumbMediaId"` // 小程序卡片封面图片的临时素材id
+	SessionFrom  string `xml:"SessionFrom" json:"SessionFrom"`   // 开发者在客服会话按钮设置的 session-from 属性
+}
+
+// TradeManageRemindEvent is pushed for trade_manage_remind_access_api and trade_manage_remind_shipping.
+type TradeManageRemindEvent struct {
+	MessageHeader
+	TransactionID   string `xml:"transaction_id" json:"transaction_id"`       // 微信支付订单号
+	MerchantID      string `xml:"merchant_id" json:"merchant_id"`             // 商户号
+	SubMerchantID   string `xml:"sub_merchant_id" json:"sub_merchant_id"`     // 子商户号
+	MerchantTradeNo string `xml:"merchant_trade_no" json:"merchant_trade_no"` // 商户订单号
+	PayTime         int64  `xml:"pay_time" json:"pay_time"`                   // 支付成功时间，秒级时间戳
+	Msg             string `xml:"msg" json:"msg"`                             // 消息文本内容
+}
+
+type TradeManageOrderSettlementEvent struct {
+	MessageHeader
+	TransactionID           string `xml:"transaction_id" json:"transaction_id"`                       // 微信支付订单号
+	MerchantID              string `xml:"merchant_id" json:"merchant_id"`                             // 商户号
+	SubMerchantID           string `xml:"sub_merchant_id" json:"sub_merchant_id"`                     // 子商户号
+	MerchantTradeNo         string `xml:"merchant_trade_no" json:"merchant_trade_no"`                 // 商户订单号
+	PayTime                 int64  `xml:"pay_time" json:"pay_time"`                                   // 支付成功时间，秒级时间戳
+	ShippedTime             int64  `xml:"shipped_time" json:"shipped_time"`                           // 发货时间，秒级时间戳
+	EstimatedSettlementTime int64  `xml:"estimated_settlement_time" json:"estimated_settlement_time"` // 预计结算时间，秒级时间戳
+	ConfirmReceiveMethod    int    `xml:"confirm_receive_method" json:"confirm_receive_method"`       // 1 手动确认收货，2 自动确认收货
+	ConfirmReceiveTime      int64  `xml:"confirm_receive_time" json:"confirm_receive_time"`           // 确认收货时间，秒级时间戳
+	SettlementTime          int64  `xml:"settlement_time" json:"settlement_time"`                     // 订单结算时间，秒级时间戳
+}
+
+// MessageHandler handles a pushed message. A non-nil error makes the server answer
+// with HTTP 500 so that WeChat retries the push; the error itself is only logged.
+type MessageHandler func(ctx context.Context, msg *Message) error
+
+type serverOptions struct {
+	timestampWindow time.Duration
+	logger          *slog.Logger
+}
+
+func newServerOptions(opts ...ServerOption) *serverOptions {
+	defaults := &serverOptions{
+		timestampWindow: DefaultPushTimestampWindow,
+		logger:          slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(defaults)
+	}
+	return defaults
+}
+
+// ServerOption configures a Server created by NewServer.
+type ServerOption = func(*serverOptions)
+
+// WithPushTimestampWindow sets how far the signed timestamp of a pushed message or of the
+// URL verification handshake may be from the current time, DefaultPushTimestampWindow by
+// default, so that a captured request cannot be replayed later. A zero or negative window
+// disables the check.
+func WithPushTimestampWindow(window time.Duration) ServerOption {
+	return func(opts *serverOptions) {
+		opts.timestampWindow = window
+	}
+}
+
+// WithServerLogger sets the logger that receives the errors returned by handlers, which are
+// not sent back to WeChat. slog.Default is used by default.
+func WithServerLogger(logger *slog.Logger) ServerOption {
+	return func(opts *serverOptions) {
+		opts.logger = logger
+	}
+}
+
+// Server is an http.Handler for the WeChat message push endpoint. It verifies signatures,
+// answers the echostr handshake, decrypts safe-mode payloads in XML or JSON and
+// dispatches messages to the registered handlers.
+type Server struct {
+	config   Config
+	token    string
+	aesKey   []byte        // nil when the push endpoint runs in plaintext mode
+	window   time.Duration // Accepted distance of push timestamps from now
+	logger   *slog.Logger  // Receives handler errors
+	mu       sync.RWMutex
+	handlers map[string]MessageHandler
+	fallback MessageHandler
+}
+
+// NewServer creates a push Server. encodingAESKey is the 43-character key configured in the
+// console; it may be empty when the endpoint runs in plaintext mode. With a key, only
+// safe-mode pushes are accepted.
+func NewServer(config Config, token, encodingAESKey string, options ...ServerOption) (*Server, error) {
+	opts := newServerOptions(options...)
+	s := &Server{
+		config:   config,
+		token:    token,
+		window:   opts.timestampWindow,
+		logger:   opts.logger,
+		handlers: make(map[string]MessageHandler),
+	}
+	if encodingAESKey != "" {
+		if len(encodingAESKey) != 43 {
+			return nil, ErrorInvalidEncodingAESKey
+		}
+		key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+		if err != nil {
+			return nil, ErrorInvalidEncodingAESKey
+		}
+		s.aesKey = key
+	}
+	return s, nil
+}
+
+// HandleMessage registers h for messages of the given MsgType.
+func (s *Server) HandleMessage(msgType string, h MessageHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers["msg:"+msgType] = h
+}
+
+// HandleEvent registers h for event messages of the given Event type.
+func (s *Server) HandleEvent(event string, h MessageHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers["event:"+event] = h
+}
+
+// HandleDefault registers h for messages that have no specific handler.
+func (s *Server) HandleDefault(h MessageHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = h
+}
+
+// HandleTypedMessage registers fn for messages of msgType, decoding them into T first.
+func HandleTypedMessage[T any](s *Server, msgType string, fn func(ctx context.Context, msg *T) error) {
+	s.HandleMessage(msgType, decodeMessageHandler(fn))
+}
+
+// HandleTypedEvent registers fn for events of the given type, decoding them into T first.
+func HandleTypedEvent[T any](s *Server, event string, fn func(ctx context.Context, event *T) error) {
+	s.HandleEvent(event, decodeMessageHandler(fn))
+}
+
+func decodeMessageHandler[T any](fn func(ctx context.Context, msg *T) error) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		var v T
+		err := msg.Decode(&v)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, &v)
+	}
+}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	timestamp, nonce := query.Get("timestamp"), query.Get("nonce")
+	if r.Method == http.MethodGet {
+		if !s.verify(query.Get("signature"), timestamp, nonce) {
+			http.Error(rw, ErrorInvalidSignature.Error(), http.StatusForbidden)
+			return
+		}
+		if !s.recent(timestamp, time.Now()) {
+			http.Error(rw, ErrorInvalidTimestamp.Error(), http.StatusForbidden)
+			return
+		}
+		_, _ = io.WriteString(rw, query.Get("echostr"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPushBodySize))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg, err := s.parseMessage(query.Get("signature"), query.Get("msg_signature"), timestamp, nonce, query.Get("encrypt_type"), body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrorInvalidSignature) || errors.Is(err, ErrorInvalidTimestamp) || errors.Is(err, ErrorPlaintextMessage) {
+			status = http.StatusForbidden
+		}
+		http.Error(rw, err.Error(), status)
+		return
+	}
+	err = s.dispatch(r.Context(), msg)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "wechat push handler failed",
+			slog.String("msg_type", msg.MsgType),
+			slog.String("event", msg.Event),
+			slog.String("error", err.Error()),
+		)
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	_, _ = io.WriteString(rw, "success")
+}
+
+func (s *Server) parseMessage(signature, msgSignature, timestamp, nonce, encryptType string, body []byte) (*Message, error) {
+	format := detectMessageFormat(body)
+	if encryptType == "aes" || msgSignature != "" {
+		var envelope struct {
+			Encrypt string `xml:"Encrypt" json:"Encrypt"`
+		}
+		err := (&Message{Format: format, Raw: body}).Decode(&envelope)
+		if err != nil {
+			return nil, err
+		}
+		if !s.verify(msgSignature, timestamp, nonce, envelope.Encrypt) {
+			return nil, ErrorInvalidSignature
+		}
+		body, err = s.decrypt(envelope.Encrypt)
+		if err != nil {
+			return nil, err
+		}
+		format = detectMessageFormat(body)
+	} else if s.aesKey != nil {
+		return nil, ErrorPlaintextMessage
+	} else if !s.verify(signature, timestamp, nonce) {
+		return nil, ErrorInvalidSignature
+	}
+	if !s.recent(timestamp, time.Now()) {
+		return nil, ErrorInvalidTimestamp
+	}
+	msg := &Message{Format: format, Raw: body}
+	err := msg.Decode(&msg.MessageHeader)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *Server) dispatch(ctx context.Context, msg *Message) error {
+	key := "msg:" + msg.MsgType
+	if msg.MsgType == MsgTypeEvent {
+		key = "event:" + msg.Event
+	}
+	s.mu.RLock()
+	h, ok := s.handlers[key]
+	if !ok {
+		h = s.fallback
+	}
+	s.mu.RUnlock()
+	if h == nil {
+		return nil
+	}
+	return h(ctx, msg)
+}
+
+// verify compares signature with sha1 of the lexicographically sorted token and params.
+func (s *Server) verify(signature string, params ...string) bool {
+	values := append([]string{s.token}, params...)
+	sort.Strings(values)
+	sum := sha1.Sum([]byte(strings.Join(values, "")))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(signature)) == 1
+}
+
+// recent reports whether the push timestamp is within the configured window of now.
+func (s *Server) recent(timestamp string, now time.Time) bool {
+	if s.window <= 0 {
+		return true
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	d := now.Sub(time.Unix(sec, 0))
+	return d <= s.window && d >= -s.window
+}
+
+// decrypt decodes a safe-mode payload: AES-256-CBC over random(16) | len(4) | msg | appid.
+func (s *Server) decrypt(encrypted string) ([]byte, error) {
+	if s.aesKey == nil {
+		return nil, ErrorInvalidEncodingAESKey
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, ErrorInvalidEncryptedData
+	}
+	block, err := aes.NewCipher(s.aesKey)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, s.aesKey[:aes.BlockSize]).CryptBlocks(plain, data)
+	plain, err = pkcs7Unpad(plain, 32)
+	if err != nil {
+		return nil, err
+	}
+	if len(plain) < 20 {
+		return nil, ErrorInvalidEncryptedData
+	}
+	size := binary.BigEndian.Uint32(plain[16:20])
+	if uint64(size) > uint64(len(plain)-20) {
+		return nil, ErrorInvalidEncryptedData
+	}
+	msg, receiver := plain[20:20+size], string(plain[20+size:])
+	if receiver != s.config.AppID {
+		return nil, fmt.Errorf("%w: %s", ErrorInvalidReceiver, receiver)
+	}
+	return msg, nil
+}
+
+func detectMessageFormat(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		return MessageFormatJSON
+	}
+	return MessageFormatXML
+}
@@ -0,0 +1,245 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testPushToken  = "push-token"
+	testPushAESKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+)
+
+func signPush(values ...string) string {
+	values = append([]string{testPushToken}, values...)
+	sort.Strings(values)
+	sum := sha1.Sum([]byte(strings.Join(values, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+func encryptPush(t *testing.T, appID string, msg []byte) string {
+	t.Helper()
+	return encryptPushWithSize(t, appID, msg, uint32(len(msg)))
+}
+
+// encryptPushWithSize encrypts msg with size as the message length in the header.
+func encryptPushWithSize(t *testing.T, appID string, msg []byte, size uint32) string {
+	t.Helper()
+	key, _ := base64.StdEncoding.DecodeString(testPushAESKey + "=")
+	plain := make([]byte, 20, 20+len(msg)+len(appID))
+	copy(plain, "0123456789abcdef")
+	binary.BigEndian.PutUint32(plain[16:20], size)
+	plain = append(append(plain, msg...), appID...)
+	plain = pkcs7Pad(plain, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("failed to create cipher: %v", err)
+	}
+	out := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, key[:aes.BlockSize]).CryptBlocks(out, plain)
+	return base64.StdEncoding.EncodeToString(out)
+}
+
+func newTestPushServer(t *testing.T, options ...ServerOption) *Server {
+	t.Helper()
+	srv, err := NewServer(Config{AppID: "wx123"}, testPushToken, testPushAESKey, options...)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	return srv
+}
+
+func TestServer_Handshake(t *testing.T) {
+	srv := newTestPushServer(t)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	query := url.Values{
+		"signature": {signPush(timestamp, "nonce")},
+		"timestamp": {timestamp},
+		"nonce":     {"nonce"},
+		"echostr":   {"hello"},
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/push?"+query.Encode(), nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("unexpected handshake response: %d %q", rec.Code, rec.Body.String())
+	}
+
+	query.Set("signature", "bad")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/push?"+query.Encode(), nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden for bad signature, got %d", rec.Code)
+	}
+
+	stale := url.Values{
+		"signature": {signPush("1700000000", "nonce")},
+		"timestamp": {"1700000000"},
+		"nonce":     {"nonce"},
+		"echostr":   {"hello"},
+	}
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/push?"+stale.Encode(), nil))
+	if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "hello") {
+		t.Errorf("expected forbidden for a stale handshake, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServer_EncryptedDispatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		plain    string
+		envelope string
+	}{
+		{
+			name:     "xml",
+			plain:    `<xml><ToUserName><![CDATA[gh_123]]></ToUserName><FromUserName><![CDATA[openid]]></FromUserName><CreateTime>1700000000</CreateTime><MsgType><![CDATA[event]]></MsgType><Event><![CDATA[subscribe_msg_popup_event]]></Event><SubscribeMsgPopupEvent><List><TemplateId><![CDATA[tpl1]]></TemplateId><SubscribeStatusString><![CDATA[accept]]></SubscribeStatusString><PopupScene>0</PopupScene></List><List><TemplateId><![CDATA[tpl2]]></TemplateId><SubscribeStatusString><![CDATA[reject]]></SubscribeStatusString><PopupScene>0</PopupScene></List></SubscribeMsgPopupEvent></xml>`,
+			envelope: `<xml><ToUserName><![CDATA[gh_123]]></ToUserName><Encrypt><![CDATA[%s]]></Encrypt></xml>`,
+		},
+		{
+			name:     "json",
+			plain:    `{"ToUserName":"gh_123","FromUserName":"openid","CreateTime":1700000000,"MsgType":"event","Event":"subscribe_msg_popup_event","List":[{"TemplateId":"tpl1","SubscribeStatusString":"accept","PopupScene":"0"},{"TemplateId":"tpl2","SubscribeStatusString":"reject","PopupScene":"0"}]}`,
+			envelope: `{"ToUserName":"gh_123","Encrypt":"%s"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestPushServer(t)
+			var got *SubscribeMsgPopupEvent
+			HandleTypedEvent(srv, EventSubscribeMsgPopup, func(ctx context.Context, event *SubscribeMsgPopupEvent) error {
+				got = event
+				return nil
+			})
+			encrypted := encryptPush(t, "wx123", []byte(tt.plain))
+			body := fmt.Sprintf(tt.envelope, encrypted)
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, newEncryptedPush(time.Now(), encrypted, body))
+			if rec.Code != http.StatusOK || rec.Body.String() != "success" {
+				t.Fatalf("unexpected response: %d %q", rec.Code, rec.Body.String())
+			}
+			if got == nil {
+				t.Fatal("handler was not called")
+			}
+			if got.FromUserName != "openid" || len(got.List) != 2 || got.List[1].TemplateID != "tpl2" || got.List[1].SubscribeStatusString != "reject" {
+				t.Errorf("unexpected event: %+v", got)
+			}
+		})
+	}
+}
+
+func TestServer_RejectsForeignReceiver(t *testing.T) {
+	srv := newTestPushServer(t)
+	encrypted := encryptPush(t, "wx999", []byte(`{"MsgType":"text","Content":"hi"}`))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, newEncryptedPush(time.Now(), encrypted, fmt.Sprintf(`{"Encrypt":"%s"}`, encrypted)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for foreign receiver, got %d", rec.Code)
+	}
+}
+
+func TestServer_RejectsOversizedLength(t *testing.T) {
+	srv := newTestPushServer(t)
+	msg := []byte(`{"MsgType":"text","Content":"hi"}`)
+	for _, size := range []uint32{uint32(len(msg) + len("wx123") + 1), 1 << 31, 1<<32 - 1} {
+		encrypted := encryptPushWithSize(t, "wx123", msg, size)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, newEncryptedPush(time.Now(), encrypted, fmt.Sprintf(`{"Encrypt":"%s"}`, encrypted)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("size %d: expected bad request, got %d", size, rec.Code)
+		}
+	}
+}
+
+func TestServer_RejectsPlaintextInSafeMode(t *testing.T) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	query := url.Values{
+		"signature": {signPush(timestamp, "nonce")},
+		"timestamp": {timestamp},
+		"nonce":     {"nonce"},
+	}
+	body := `{"ToUserName":"gh_123","FromUserName":"openid","MsgType":"text","Content":"hi"}`
+	rec := httptest.NewRecorder()
+	newTestPushServer(t).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/push?"+query.Encode(), strings.NewReader(body)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden for a plaintext push in safe mode, got %d", rec.Code)
+	}
+
+	plain, err := NewServer(Config{AppID: "wx123"}, testPushToken, "")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	plain.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/push?"+query.Encode(), strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected a plaintext push to be accepted without a key, got %d", rec.Code)
+	}
+}
+
+func TestServer_RejectsStaleTimestamp(t *testing.T) {
+	encrypted := encryptPush(t, "wx123", []byte(`{"MsgType":"text","Content":"hi"}`))
+	body := fmt.Sprintf(`{"Encrypt":"%s"}`, encrypted)
+	for name, tc := range map[string]struct {
+		at     time.Time
+		window time.Duration
+		want   int
+	}{
+		"stale":    {time.Now().Add(-time.Hour), DefaultPushTimestampWindow, http.StatusForbidden},
+		"future":   {time.Now().Add(time.Hour), DefaultPushTimestampWindow, http.StatusForbidden},
+		"widened":  {time.Now().Add(-time.Hour), 2 * time.Hour, http.StatusOK},
+		"disabled": {time.Unix(1700000000, 0), 0, http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		newTestPushServer(t, WithPushTimestampWindow(tc.window)).ServeHTTP(rec, newEncryptedPush(tc.at, encrypted, body))
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", name, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestServer_HandlerErrorNotExposed(t *testing.T) {
+	var logs bytes.Buffer
+	srv := newTestPushServer(t, WithServerLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	srv.HandleDefault(func(ctx context.Context, msg *Message) error {
+		return errors.New("db password rejected")
+	})
+	encrypted := encryptPush(t, "wx123", []byte(`{"MsgType":"text","Content":"hi"}`))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, newEncryptedPush(time.Now(), encrypted, fmt.Sprintf(`{"Encrypt":"%s"}`, encrypted)))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected internal server error, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "db password") {
+		t.Errorf("handler error leaked in response %q", rec.Body.String())
+	}
+	if !strings.Contains(logs.String(), "db password rejected") {
+		t.Errorf("expected the handler error to be logged, got %q", logs.String())
+	}
+}
+
+// newEncryptedPush returns a signed safe-mode push of body sent at the given time.
+func newEncryptedPush(at time.Time, encrypted, body string) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	query := url.Values{
+		"timestamp":     {timestamp},
+		"nonce":         {"nonce"},
+		"encrypt_type":  {"aes"},
+		"msg_signature": {signPush(timestamp, "nonce", encrypted)},
+	}
+	return httptest.NewRequest(http.MethodPost, "/push?"+query.Encode(), strings.NewReader(body))
+}
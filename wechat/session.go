@@ -0,0 +1,146 @@
+package wechat
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var ErrorSessionKeyNotFound = errors.New("session key not found")
+
+// SessionStore keeps the session_key returned by JsCode2Session, by openid, so it can be
+// checked and used to decrypt open data later.
+type SessionStore interface {
+	GetSessionKey(ctx context.Context, openID string) (string, bool, error)
+	SetSessionKey(ctx context.Context, openID string, sessionKey string) error
+}
+
+// CacheSessionStore is a SessionStore that keeps session keys in a Cache.
+type CacheSessionStore struct {
+	cache  Cache
+	prefix string
+	ttl    time.Duration
+}
+
+// NewCacheSessionStore returns a SessionStore that keeps session keys in cache under
+// "<prefix>:<openid>" for ttl. The prefix should be unique to the AppID.
+func NewCacheSessionStore(cache Cache, prefix string, ttl time.Duration) *CacheSessionStore {
+	return &CacheSessionStore{cache: cache, prefix: prefix, ttl: ttl}
+}
+
+func (s *CacheSessionStore) GetSessionKey(ctx context.Context, openID string) (string, bool, error) {
+	return s.cache.Get(ctx, s.prefix+":"+openID)
+}
+
+func (s *CacheSessionStore) SetSessionKey(ctx context.Context, openID string, sessionKey string) error {
+	return s.cache.SetWithTTL(ctx, s.prefix+":"+openID, sessionKey, s.ttl)
+}
+
+var _ SessionStore = (*CacheSessionStore)(nil)
+
+// sessionSignature is the signature expected by the session key APIs, the
+// HMAC-SHA256 of an empty string keyed by the session key.
+func sessionSignature(sessionKey string) string {
+	mac := hmac.New(sha256.New, []byte(sessionKey))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckSessionKey checks that sessionKey is still the valid session key of openID.
+// An outdated key is reported as ErrorInvalidRequestSignature; the user then has to log in again.
+func (w *Wechat) CheckSessionKey(ctx context.Context, openID, sessionKey string, options ...RequestOption) error {
+	_, err := withAccessToken(ctx, w, func(ctx context.Context, accessToken string) (*ErrResponse, error) {
+		resp, err := w.client.R().
+			Clone(ctx).
+			SetQueryParams(map[string]string{
+				"access_token": accessToken,
+				"openid":       openID,
+				"signature":    sessionSignature(sessionKey),
+				"sig_method":   "hmac_sha256",
+			}).
+			Get("/wxa/checksession")
+		if err != nil {
+			return nil, err
+		}
+		return loadSuccessResponse(resp, func(a *ErrResponse) error {
+			return checkResponseError(a.ErrCode, a.ErrMsg)
+		})
+	}, options...)
+	return err
+}
+
+// ResetUserSessionKey replaces the valid session key sessionKey of openID with a new one,
+// which is returned. The old key stops working, so the call is not retried on transient
+// failures unless a policy is passed with WithRequestRetryPolicy.
+func (w *Wechat) ResetUserSessionKey(ctx context.Context, openID, sessionKey string, options ...RequestOption) (*ResetUserSessionKeyResponse, error) {
+	return withAccessToken(ctx, w, func(ctx context.Context, accessToken string) (*ResetUserSessionKeyResponse, error) {
+		resp, err := w.client.R().
+			Clone(ctx).
+			SetQueryParams(map[string]string{
+				"access_token": accessToken,
+				"openid":       openID,
+				"signature":    sessionSignature(sessionKey),
+				"sig_method":   "hmac_sha256",
+			}).
+			Get("/wxa/resetusersessionkey")
+		if err != nil {
+			return nil, err
+		}
+		return loadSuccessResponse(resp, func(a *ResetUserSessionKeyResponse) error {
+			return checkResponseError(a.ErrCode, a.ErrMsg)
+		})
+	}, append([]RequestOption{withNonIdempotent()}, options...)...)
+}
+
+// Login exchanges a js_code with JsCode2Session and saves the session key in store.
+func (w *Wechat) Login(ctx context.Context, store SessionStore, code string) (*JsCode2SessionResponse, error) {
+	session, err := w.JsCode2Session(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	err = store.SetSessionKey(ctx, session.OpenID, session.SessionKey)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// SessionKey returns the session key of openID from store after checking it with WeChat,
+// so it can be used to decrypt open data. It returns ErrorSessionKeyNotFound if store has
+// no key for openID, and ErrorInvalidRequestSignature if the key is outdated.
+func (w *Wechat) SessionKey(ctx context.Context, store SessionStore, openID string, options ...RequestOption) (string, error) {
+	sessionKey, exist, err := store.GetSessionKey(ctx, openID)
+	if err != nil {
+		return "", err
+	}
+	if !exist {
+		return "", ErrorSessionKeyNotFound
+	}
+	err = w.CheckSessionKey(ctx, openID, sessionKey, options...)
+	if err != nil {
+		return "", err
+	}
+	return sessionKey, nil
+}
+
+// RotateSessionKey resets the session key of openID kept in store and saves the new one.
+func (w *Wechat) RotateSessionKey(ctx context.Context, store SessionStore, openID string, options ...RequestOption) (string, error) {
+	sessionKey, exist, err := store.GetSessionKey(ctx, openID)
+	if err != nil {
+		return "", err
+	}
+	if !exist {
+		return "", ErrorSessionKeyNotFound
+	}
+	reset, err := w.ResetUserSessionKey(ctx, openID, sessionKey, options...)
+	if err != nil {
+		return "", err
+	}
+	err = store.SetSessionKey(ctx, openID, reset.SessionKey)
+	if err != nil {
+		return "", err
+	}
+	return reset.SessionKey, nil
+}
@@ -0,0 +1,59 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+)
+
+func TestSessionSignature(t *testing.T) {
+	// HMAC-SHA256 of an empty string keyed by "key"
+	want := "5d5d139563c95b5967b9bd9a8c9b233a9dedb45072794cd232dc1b74832607d0"
+	if got := sessionSignature("key"); got != want {
+		t.Errorf("sessionSignature = %s, want %s", got, want)
+	}
+}
+
+func TestWechat_SessionKey(t *testing.T) {
+	wx, srv := newTestWechat(t, NewMemoryCache(0))
+	store := NewCacheSessionStore(NewMemoryCache(0), "session:"+srv.AppID, time.Hour)
+	ctx := context.Background()
+
+	_, err := wx.SessionKey(ctx, store, "openid-code1")
+	if !errors.Is(err, ErrorSessionKeyNotFound) {
+		t.Fatalf("expected ErrorSessionKeyNotFound, got %v", err)
+	}
+	session, err := wx.Login(ctx, store, "code1")
+	if err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	sessionKey, err := wx.SessionKey(ctx, store, session.OpenID)
+	if err != nil || sessionKey != wechattest.SessionKey("code1") {
+		t.Fatalf("SessionKey = %q, %v", sessionKey, err)
+	}
+	if q := srv.Calls("/wxa/checksession")[0].Query; q.Get("signature") != sessionSignature(sessionKey) || q.Get("sig_method") != "hmac_sha256" {
+		t.Errorf("unexpected checksession query %v", q)
+	}
+
+	rotated, err := wx.RotateSessionKey(ctx, store, session.OpenID)
+	if err != nil {
+		t.Fatalf("RotateSessionKey returned error: %v", err)
+	}
+	if rotated == sessionKey {
+		t.Error("expected a new session key")
+	}
+	if got, err := wx.SessionKey(ctx, store, session.OpenID); err != nil || got != rotated {
+		t.Errorf("expected the rotated key to be stored and valid, got %q, %v", got, err)
+	}
+	err = wx.CheckSessionKey(ctx, session.OpenID, sessionKey)
+	if !errors.Is(err, ErrorInvalidRequestSignature) {
+		t.Errorf("expected the old key to be rejected, got %v", err)
+	}
+	_, err = wx.ResetUserSessionKey(ctx, session.OpenID, sessionKey)
+	if !errors.Is(err, ErrorInvalidRequestSignature) {
+		t.Errorf("expected reset with the old key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package wechat
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentationName is the OpenTelemetry instrumentation scope of this package.
+const instrumentationName = "github.com/go-sphere/weixin-mp-api/wechat"
+
+// Attribute keys recorded on spans and metrics.
+const (
+	AttrAppID              = attribute.Key("wechat.app_id")
+	AttrEndpoint           = attribute.Key("wechat.endpoint")
+	AttrErrCode            = attribute.Key("wechat.errcode")
+	AttrRid                = attribute.Key("wechat.rid")
+	AttrKind               = attribute.Key("wechat.kind")
+	AttrCacheHit           = attribute.Key("wechat.cache.hit")
+	AttrSingleflightShared = attribute.Key("wechat.singleflight.shared")
+	attrHTTPMethod         = attribute.Key("http.request.method")
+	attrHTTPStatus         = attribute.Key("http.response.status_code")
+	attrErrorType          = attribute.Key("error.type")
+)
+
+// WithTracerProvider records a span for every HTTP exchange, access token lookup, singleflight
+// wait and token or ticket refresh. Tracing is disabled by default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(opts *options) {
+		opts.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider records the metrics wechat.client.request.duration, wechat.client.errors,
+// wechat.token.refreshes and wechat.cache.lookups. Metrics are disabled by default.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(opts *options) {
+		opts.meterProvider = provider
+	}
+}
+
+type telemetry struct {
+	appID           attribute.KeyValue
+	tracer          trace.Tracer
+	requestDuration metric.Float64Histogram
+	errors          metric.Int64Counter
+	refreshes       metric.Int64Counter
+	cacheLookups    metric.Int64Counter
+}
+
+func newTelemetry(appID string, tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) *telemetry {
+	if tracerProvider == nil {
+		tracerProvider = tracenoop.NewTracerProvider()
+	}
+	if meterProvider == nil {
+		meterProvider = metricnoop.NewMeterProvider()
+	}
+	meter := meterProvider.Meter(instrumentationName)
+	t := &telemetry{
+		appID:  AttrAppID.String(appID),
+		tracer: tracerProvider.Tracer(instrumentationName),
+	}
+	// Instrument creation only fails on invalid names, and then returns a usable no-op instrument.
+	t.requestDuration, _ = meter.Float64Histogram("wechat.client.request.duration",
+		metric.WithDescription("Duration of HTTP exchanges with the WeChat API."),
+		metric.WithUnit("s"))
+	t.errors, _ = meter.Int64Counter("wechat.client.errors",
+		metric.WithDescription("Failed HTTP exchanges with the WeChat API, by endpoint and errcode."),
+		metric.WithUnit("{error}"))
+	t.refreshes, _ = meter.Int64Counter("wechat.token.refreshes",
+		metric.WithDescription("Access token and ticket refreshes fetched from WeChat."),
+		metric.WithUnit("{refresh}"))
+	t.cacheLookups, _ = meter.Int64Counter("wechat.cache.lookups",
+		metric.WithDescription("Access token and ticket cache lookups, by hit or miss."),
+		metric.WithUnit("{lookup}"))
+	return t
+}
+
+// Handle is the telemetry Middleware, installed outermost when telemetry is enabled so
+// that other middlewares see the span in their context.
+func (t *telemetry) Handle(ctx context.Context, call *CallInfo, next func(ctx context.Context) error) error {
+	ctx, span := t.tracer.Start(ctx, call.Method+" "+call.Endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.appID, AttrEndpoint.String(call.Endpoint), attrHTTPMethod.String(call.Method)))
+	defer span.End()
+	err := next(ctx)
+
+	attrs := []attribute.KeyValue{t.appID, AttrEndpoint.String(call.Endpoint), attrHTTPMethod.String(call.Method)}
+	if call.StatusCode != 0 {
+		attrs = append(attrs, attrHTTPStatus.Int(call.StatusCode))
+	}
+	if call.Err != nil {
+		if code := ErrCodeOf(call.Err); code != 0 {
+			attrs = append(attrs, AttrErrCode.Int(code))
+			span.SetAttributes(AttrRid.String(RidOf(call.Err)))
+		} else {
+			attrs = append(attrs, attrErrorType.String("transport"))
+		}
+		span.RecordError(call.Err)
+		span.SetStatus(codes.Error, call.Err.Error())
+		t.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+	span.SetAttributes(attrs...)
+	t.requestDuration.Record(ctx, call.Duration.Seconds(), metric.WithAttributes(attrs...))
+	return err
+}
+
+// cacheLookup records a token or ticket cache lookup.
+func (t *telemetry) cacheLookup(ctx context.Context, kind string, hit bool) {
+	t.cacheLookups.Add(ctx, 1, metric.WithAttributes(t.appID, AttrKind.String(kind), AttrCacheHit.Bool(hit)))
+	trace.SpanFromContext(ctx).SetAttributes(AttrCacheHit.Bool(hit))
+}
+
+// startSpan starts an internal span for kind, such as "wechat.GetAccessToken".
+func (t *telemetry) startSpan(ctx context.Context, name, kind string) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, trace.WithAttributes(t.appID, AttrKind.String(kind)))
+}
+
+// endSpan records err on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// singleflight runs refresh through w.sf under key within a span, so that callers waiting
+// for another caller's refresh show up in traces with wechat.singleflight.shared set.
+func (w *Wechat) singleflight(ctx context.Context, kind, key string, refresh func(ctx context.Context) (*refreshResult, error)) (*refreshResult, error) {
+	ctx, span := w.telemetry.startSpan(ctx, "wechat.singleflight "+kind, kind)
+	result, err, shared := w.sf.Do(key, func() (any, error) {
+		return refresh(ctx)
+	})
+	span.SetAttributes(AttrSingleflightShared.Bool(shared))
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*refreshResult), nil
+}
+
+// refresh fetches a token or ticket from WeChat within a span and counts the refresh.
+func (t *telemetry) refresh(ctx context.Context, kind string, fetch func(ctx context.Context) (*refreshResult, error)) (*refreshResult, error) {
+	ctx, span := t.startSpan(ctx, "wechat.refresh "+kind, kind)
+	result, err := fetch(ctx)
+	endSpan(span, err)
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	t.refreshes.Add(ctx, 1, metric.WithAttributes(t.appID, AttrKind.String(kind), attribute.String("wechat.refresh.status", status)))
+	return result, err
+}
@@ -0,0 +1,154 @@
+package wechat
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTelemetry(t *testing.T, options ...Option) (*Wechat, *wechattest.Server, *tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() {
+		_ = tp.Shutdown(context.Background())
+		_ = mp.Shutdown(context.Background())
+	})
+	wx, srv := newTestWechat(t, NewMemoryCache(0), append([]Option{WithTracerProvider(tp), WithMeterProvider(mp)}, options...)...)
+	return wx, srv, exporter, reader
+}
+
+func collectSums(t *testing.T, reader *sdkmetric.ManualReader, name string) map[attribute.Distinct]metricdata.DataPoint[int64] {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	err := reader.Collect(context.Background(), &rm)
+	if err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	points := make(map[attribute.Distinct]metricdata.DataPoint[int64])
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				points[dp.Attributes.Equivalent()] = dp
+			}
+		}
+	}
+	return points
+}
+
+func sumWhere(points map[attribute.Distinct]metricdata.DataPoint[int64], kv attribute.KeyValue) int64 {
+	var n int64
+	for _, dp := range points {
+		if v, ok := dp.Attributes.Value(kv.Key); ok && v == kv.Value {
+			n += dp.Value
+		}
+	}
+	return n
+}
+
+func TestTelemetry_Spans(t *testing.T) {
+	wx, _, exporter, _ := newTestTelemetry(t)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = wx.GetAccessToken(ctx, true)
+		}()
+	}
+	wg.Wait()
+	_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if err != nil {
+		t.Fatalf("GetQrCode returned error: %v", err)
+	}
+
+	counts := make(map[string]int)
+	spans := exporter.GetSpans()
+	byID := make(map[string]tracetest.SpanStub)
+	for _, s := range spans {
+		counts[s.Name]++
+		byID[s.SpanContext.SpanID().String()] = s
+	}
+	if counts["wechat.GetAccessToken"] != 5 || counts["wechat.singleflight access_token"] != 4 {
+		t.Errorf("unexpected span counts %v", counts)
+	}
+	if counts["wechat.refresh access_token"] != counts["GET /cgi-bin/token"] || counts["GET /cgi-bin/token"] == 0 {
+		t.Errorf("expected one token request per refresh, got %v", counts)
+	}
+	if counts["POST /wxa/getwxacodeunlimit"] != 1 {
+		t.Errorf("expected a span for the qrcode request, got %v", counts)
+	}
+	for _, s := range spans {
+		if s.Name != "GET /cgi-bin/token" {
+			continue
+		}
+		refresh, ok := byID[s.Parent.SpanID().String()]
+		if !ok || refresh.Name != "wechat.refresh access_token" {
+			t.Errorf("expected token request to be a child of the refresh span, got parent %q", refresh.Name)
+		}
+	}
+}
+
+func TestTelemetry_Metrics(t *testing.T) {
+	wx, srv, exporter, reader := newTestTelemetry(t)
+	ctx := context.Background()
+	for range 2 {
+		_, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+		if err != nil {
+			t.Fatalf("GetQrCode returned error: %v", err)
+		}
+	}
+	srv.FailNext("/wxa/getwxacodeunlimit", ErrCodeInvalidPage, "invalid page rid: 6523d1a2-5f6e7d8c-1a2b3c4d")
+	_, _ = wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+
+	lookups := collectSums(t, reader, "wechat.cache.lookups")
+	if hits, misses := sumWhere(lookups, AttrCacheHit.Bool(true)), sumWhere(lookups, AttrCacheHit.Bool(false)); hits != 2 || misses != 1 {
+		t.Errorf("expected 2 cache hits and 1 miss, got %d and %d", hits, misses)
+	}
+	if n := sumWhere(collectSums(t, reader, "wechat.token.refreshes"), AttrKind.String(cacheKindAccessToken)); n != 1 {
+		t.Errorf("expected 1 refresh, got %d", n)
+	}
+	errs := collectSums(t, reader, "wechat.client.errors")
+	if n := sumWhere(errs, AttrErrCode.Int(ErrCodeInvalidPage)); n != 1 {
+		t.Errorf("expected 1 error with errcode 41030, got %d", n)
+	}
+	if n := sumWhere(errs, AttrEndpoint.String("/wxa/getwxacodeunlimit")); n != 1 {
+		t.Errorf("expected errors to be grouped by endpoint, got %d", n)
+	}
+
+	var rm metricdata.ResourceMetrics
+	_ = reader.Collect(ctx, &rm)
+	var requests uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == "wechat.client.request.duration" {
+				for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+					requests += dp.Count
+				}
+			}
+		}
+	}
+	if requests != 4 {
+		t.Errorf("expected 4 recorded requests, got %d", requests)
+	}
+
+	for _, s := range exporter.GetSpans() {
+		if s.Name == "POST /wxa/getwxacodeunlimit" && s.Status.Code.String() == "Error" {
+			return
+		}
+	}
+	t.Error("expected the failed request span to have an error status")
+}
@@ -7,12 +7,17 @@ import "unicode/utf8"
 type requestOptions struct {
 	retryable         bool
 	reloadAccessToken bool
+	retryPolicy       *RetryPolicy
+	nonIdempotent     bool
+	rejectedToken     string // access token rejected by the previous attempt, never reused by the reload
 }
 
 func newRequestOptions(opts ...RequestOption) *requestOptions {
 	defaults := &requestOptions{
 		retryable:         true,
 		reloadAccessToken: false,
+		retryPolicy:       nil,
+		nonIdempotent:     false,
 	}
 	for _, opt := range opts {
 		opt(defaults)
@@ -34,10 +39,28 @@ func WithReloadAccessToken(reload bool) RequestOption {
 	}
 }
 
+// WithRequestRetryPolicy overrides the client's RetryPolicy for one call.
+// Pass NoRetry to opt out of transient retries.
+func WithRequestRetryPolicy(policy RetryPolicy) RequestOption {
+	return func(opts *requestOptions) {
+		opts.retryPolicy = &policy
+	}
+}
+
+// withNonIdempotent marks a call that must not be repeated after a transient failure,
+// since WeChat may have already acted on it, unless a per-call policy asks for it.
+func withNonIdempotent() RequestOption {
+	return func(opts *requestOptions) {
+		opts.nonIdempotent = true
+	}
+}
+
 func WithClone(opts *requestOptions) RequestOption {
 	return func(o *requestOptions) {
 		o.retryable = opts.retryable
 		o.reloadAccessToken = opts.reloadAccessToken
+		o.retryPolicy = opts.retryPolicy
+		o.nonIdempotent = opts.nonIdempotent
 	}
 }
 
@@ -2,8 +2,12 @@ package wechat
 
 import (
 	"context"
+	"crypto/tls"
+	"net/http"
 	"time"
 
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/singleflight"
 	"resty.dev/v3"
 )
@@ -27,10 +31,12 @@ func (e MiniAppEnv) String() string {
 
 // Config holds the configuration parameters for WeChat API integration.
 type Config struct {
-	AppID     string     `json:"app_id" yaml:"app_id"`         // WeChat application ID
-	AppSecret string     `json:"app_secret" yaml:"app_secret"` // WeChat application secret
-	Proxy     string     `json:"proxy" yaml:"proxy"`           // Optional proxy server URL
-	Env       MiniAppEnv `json:"env" yaml:"env"`               // Mini Program environment
+	AppID       string     `json:"app_id" yaml:"app_id"`             // WeChat application ID
+	AppSecret   string     `json:"app_secret" yaml:"app_secret"`     // WeChat application secret
+	Proxy       string     `json:"proxy" yaml:"proxy"`               // Optional proxy server URL
+	Env         MiniAppEnv `json:"env" yaml:"env"`                   // Mini Program environment
+	StableToken bool       `json:"stable_token" yaml:"stable_token"` // Fetch access tokens from /cgi-bin/stable_token
+	Alias       string     `json:"alias" yaml:"alias"`               // Optional name for Registry lookups
 }
 
 type Cache interface {
@@ -38,38 +44,321 @@ type Cache interface {
 	SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error
 }
 
+// AccessTokenProvider supplies the access tokens used for API calls. The default provider
+// fetches tokens from WeChat itself and keeps them in the Cache; a custom provider can
+// obtain them from a central token service instead.
+type AccessTokenProvider interface {
+	// AccessToken returns a valid access token. reload asks the provider to bypass any cached value.
+	AccessToken(ctx context.Context, reload bool) (string, error)
+	// InvalidateAccessToken reports that WeChat rejected token as invalid or expired.
+	InvalidateAccessToken(ctx context.Context, token string) error
+}
+
+// AccessTokenProviderFunc adapts a function to an AccessTokenProvider whose
+// InvalidateAccessToken is a no-op.
+type AccessTokenProviderFunc func(ctx context.Context, reload bool) (string, error)
+
+func (f AccessTokenProviderFunc) AccessToken(ctx context.Context, reload bool) (string, error) {
+	return f(ctx, reload)
+}
+
+func (f AccessTokenProviderFunc) InvalidateAccessToken(ctx context.Context, token string) error {
+	return nil
+}
+
+// cachedAccessTokenProvider is the default AccessTokenProvider. It reads tokens from the
+// Cache and refreshes them from WeChat through singleflight.
+type cachedAccessTokenProvider struct {
+	w *Wechat
+}
+
+func (p *cachedAccessTokenProvider) AccessToken(ctx context.Context, reload bool) (string, error) {
+	key := cacheKindAccessToken
+	if reload {
+		stale, ok := rejectedToken(ctx)
+		if !ok {
+			var err error
+			stale, _, err = p.w.cacheGet(ctx, key)
+			if err != nil {
+				return "", err
+			}
+		}
+		result, err := p.w.refreshAccessToken(ctx, "reload:"+stale, reuseExcept(stale), false)
+		if err != nil {
+			return "", err
+		}
+		return result.value, nil
+	}
+	token, exist, err := p.w.cacheGet(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	p.w.telemetry.cacheLookup(ctx, key, exist)
+	if exist {
+		return token, nil
+	}
+	result, err := p.w.refreshAccessToken(ctx, "", reuseAny, false)
+	if err != nil {
+		return "", err
+	}
+	return result.value, nil
+}
+
+func (p *cachedAccessTokenProvider) InvalidateAccessToken(ctx context.Context, token string) error {
+	return nil // the following reload receives token with its context and replaces it
+}
+
+type rejectedTokenKey struct{}
+
+// withRejectedToken passes the access token that WeChat has just rejected to the reload
+// made with ctx, so that the reload never returns it again.
+func withRejectedToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, rejectedTokenKey{}, token)
+}
+
+func rejectedToken(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(rejectedTokenKey{}).(string)
+	return token, ok
+}
+
 // Wechat represents a WeChat API client with token management and caching capabilities.
 // It handles access token lifecycle, API requests, and provides thread-safe operations.
 type Wechat struct {
-	config Config             // WeChat application configuration
-	sf     singleflight.Group // Prevents duplicate token requests
-	cache  Cache              // Cache for access tokens and tickets
-	client *resty.Client      // HTTP client for WeChat API requests
+	config      Config              // WeChat application configuration
+	keys        cacheKeys           // Namespacing of cache keys
+	sf          singleflight.Group  // Prevents duplicate token requests
+	cache       Cache               // Cache for access tokens and tickets
+	locker      Locker              // Optional cross-replica lock around token refreshes
+	lockTTL     time.Duration       // How long a refresh may hold the lock
+	retryPolicy RetryPolicy         // Default policy for transient failures
+	quota       *quotaLimiter       // Optional per-endpoint rate limits and daily quotas
+	telemetry   *telemetry          // OpenTelemetry instruments, no-ops unless configured
+	failover    *failoverTransport  // Optional failover between API hosts
+	oauthState  oauthState          // Signing of web OAuth2 states
+	watermark   time.Duration       // Maximum age of decrypted open-data watermarks
+	tokens      AccessTokenProvider // Source of access tokens for API calls
+	client      *resty.Client       // HTTP client for WeChat API requests
+}
+
+// DefaultBaseURL is the WeChat API endpoint used unless overridden with WithBaseURL.
+const DefaultBaseURL = "https://api.weixin.qq.com"
+
+type options struct {
+	baseURL          string
+	httpClient       *http.Client
+	transport        http.RoundTripper
+	timeout          time.Duration
+	tlsConfig        *tls.Config
+	userAgent        string
+	tokens           AccessTokenProvider
+	locker           Locker
+	keyPrefix        string
+	legacyKeys       bool
+	retry            RetryPolicy
+	limits           map[string]EndpointLimit
+	quotaWarning     QuotaWarningFunc
+	middlewares      []Middleware
+	tracerProvider   trace.TracerProvider
+	meterProvider    metric.MeterProvider
+	baseURLs         []string
+	failoverCooldown time.Duration
+	oauthStateKey    []byte
+	oauthStateMaxAge time.Duration
+	watermarkMaxAge  time.Duration
+}
+
+func newOptions(opts ...Option) *options {
+	defaults := &options{
+		baseURL:          DefaultBaseURL,
+		timeout:          time.Second * 30,
+		keyPrefix:        DefaultCacheKeyPrefix,
+		retry:            NoRetry,
+		failoverCooldown: DefaultFailoverCooldown,
+		oauthStateMaxAge: DefaultOAuthStateMaxAge,
+		watermarkMaxAge:  DefaultWatermarkMaxAge,
+	}
+	for _, opt := range opts {
+		opt(defaults)
+	}
+	return defaults
+}
+
+// Option configures a Wechat client created by NewWechat.
+type Option = func(*options)
+
+// WithBaseURL points the client at a different API host, such as a regional domain,
+// an egress gateway or a wechattest.Server.
+func WithBaseURL(baseURL string) Option {
+	return func(opts *options) {
+		opts.baseURL = baseURL
+	}
+}
+
+// WithHTTPClient makes the client send requests through hc, for example one that is
+// shared between several Wechat instances or routed through an egress gateway.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(opts *options) {
+		opts.httpClient = hc
+	}
+}
+
+// WithTransport replaces the underlying http.RoundTripper. TLS and proxy settings only
+// apply when the transport is an *http.Transport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(opts *options) {
+		opts.transport = transport
+	}
+}
+
+// WithTimeout sets the per-request timeout, 30 seconds by default. Zero disables it.
+func WithTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.timeout = timeout
+	}
+}
+
+// WithTLSConfig sets the TLS client configuration of the transport.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(opts *options) {
+		opts.tlsConfig = config
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(opts *options) {
+		opts.userAgent = userAgent
+	}
+}
+
+// WithAccessTokenProvider makes the client obtain access tokens from provider instead of
+// fetching and caching them itself.
+func WithAccessTokenProvider(provider AccessTokenProvider) Option {
+	return func(opts *options) {
+		opts.tokens = provider
+	}
+}
+
+// WithLocker serializes token and ticket refreshes across replicas that share the Cache.
+// While one replica refreshes, the others wait for the lock and then re-read the cache.
+func WithLocker(locker Locker) Option {
+	return func(opts *options) {
+		opts.locker = locker
+	}
+}
+
+// WithCacheKeyPrefix sets the prefix of cache keys, which have the form
+// "<prefix>:<appid>:<kind>". The default is DefaultCacheKeyPrefix.
+func WithCacheKeyPrefix(prefix string) Option {
+	return func(opts *options) {
+		opts.keyPrefix = prefix
+	}
+}
+
+// WithLegacyCacheKeys eases the migration from the un-namespaced "AccessToken" and "JsTicket"
+// keys used by earlier versions. Values are also written to the legacy keys and read from
+// them on a miss, so old and new instances can share a Cache during a rolling upgrade.
+// Remove it once every instance has been upgraded, since legacy keys are not per AppID.
+func WithLegacyCacheKeys(enabled bool) Option {
+	return func(opts *options) {
+		opts.legacyKeys = enabled
+	}
+}
+
+// WithRetryPolicy sets the default RetryPolicy for calls made with an access token.
+// By default transient failures are not retried. Non-idempotent calls such as SendMessage
+// ignore it unless a policy is passed to them with WithRequestRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(opts *options) {
+		opts.retry = policy
+	}
 }
 
 // NewWechat creates a new WeChat API client with the provided configuration.
 // It initializes the HTTP client with appropriate timeouts, base URL, and optional proxy settings.
 // If no environment is specified, it defaults to the release environment.
-func NewWechat(config Config, cache Cache) *Wechat {
+// Options override the base URL, HTTP client, transport, timeout, TLS settings and user agent.
+func NewWechat(config Config, cache Cache, options ...Option) *Wechat {
 	if config.Env == "" {
 		config.Env = MiniAppEnvRelease
 	}
-	client := resty.New().
-		SetTimeout(time.Second * 30).
-		SetBaseURL("https://api.weixin.qq.com")
+	opts := newOptions(options...)
+	client := resty.New()
+	if opts.httpClient != nil {
+		hc := *opts.httpClient // resty modifies the client, which may be shared
+		client = resty.NewWithClient(&hc)
+	}
+	if opts.transport != nil {
+		client = client.SetTransport(opts.transport)
+	}
+	client = client.
+		SetTimeout(opts.timeout).
+		SetBaseURL(opts.baseURL)
+	if opts.tlsConfig != nil || config.Proxy != "" {
+		// the transport may be shared with the caller, so the settings go to a copy
+		if transport, ok := client.Transport().(*http.Transport); ok {
+			client = client.SetTransport(transport.Clone())
+		}
+	}
+	if opts.tlsConfig != nil {
+		client = client.SetTLSClientConfig(opts.tlsConfig)
+	}
+	if opts.userAgent != "" {
+		client = client.SetHeader("User-Agent", opts.userAgent)
+	}
 	if config.Proxy != "" {
 		client = client.SetProxy(config.Proxy)
 	}
-	return &Wechat{
-		config: config,
-		cache:  cache,
-		client: client,
+	next := client.Client().Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	failover := newFailoverTransport(next, opts.baseURLs, opts.failoverCooldown)
+	if failover != nil {
+		next = failover
+		client = client.SetTransport(failover)
+	}
+	tel := newTelemetry(config.AppID, opts.tracerProvider, opts.meterProvider)
+	middlewares := opts.middlewares
+	if opts.tracerProvider != nil || opts.meterProvider != nil {
+		middlewares = append([]Middleware{tel}, middlewares...)
+	}
+	if len(middlewares) > 0 {
+		client = client.SetTransport(&middlewareTransport{next: next, middlewares: middlewares})
 	}
+	w := &Wechat{
+		config:      config,
+		cache:       cache,
+		tokens:      opts.tokens,
+		keys:        cacheKeys{prefix: opts.keyPrefix, appID: config.AppID, legacy: opts.legacyKeys},
+		locker:      opts.locker,
+		lockTTL:     refreshLockTTL(opts.timeout),
+		client:      client,
+		retryPolicy: opts.retry,
+		quota:       newQuotaLimiter(opts.limits, opts.quotaWarning),
+		telemetry:   tel,
+		failover:    failover,
+		oauthState:  oauthState{key: opts.oauthStateKey, maxAge: opts.oauthStateMaxAge},
+		watermark:   opts.watermarkMaxAge,
+	}
+	if len(w.oauthState.key) == 0 {
+		w.oauthState.key = []byte(config.AppSecret) // still empty without an AppSecret, which NewOAuthState rejects
+	}
+	if w.tokens == nil {
+		w.tokens = &cachedAccessTokenProvider{w: w}
+	}
+	if w.quota != nil {
+		client.AddRequestMiddleware(w.limitRequest)
+	}
+	return w
 }
 
-// GetAccessToken retrieves a valid WeChat access token, using cache when possible.
-// It implements automatic token refresh with singleflight to prevent duplicate requests.
-// The token is cached with a 2-second safety margin before the actual expiration time.
+// GetAccessToken retrieves a valid WeChat access token from the configured AccessTokenProvider.
+// The default provider uses the cache when possible and refreshes the token with singleflight
+// to prevent duplicate requests. The token is cached with a 2-second safety margin before the actual expiration time.
+// When Config.StableToken is set, tokens come from /cgi-bin/stable_token without
+// force_refresh, so a reload returns the token that is currently valid for the AppID
+// instead of invalidating the one held by other services.
 //
 // Parameters:
 //   - ctx: Context for request cancellation and timeout
@@ -77,18 +366,93 @@ func NewWechat(config Config, cache Cache) *Wechat {
 //
 // Returns the access token string or an error if retrieval fails.
 func (w *Wechat) GetAccessToken(ctx context.Context, reload bool) (string, error) {
-	key := "AccessToken"
-	if !reload {
-		token, exist, err := w.cache.Get(ctx, key)
-		if err != nil {
-			return "", err
-		}
-		if exist {
-			return token, nil
-		}
+	ctx, span := w.telemetry.startSpan(ctx, "wechat.GetAccessToken", cacheKindAccessToken)
+	token, err := w.tokens.AccessToken(ctx, reload)
+	endSpan(span, err)
+	return token, err
+}
+
+// ForceRefreshAccessToken obtains a brand-new access token and caches it.
+// With Config.StableToken it calls /cgi-bin/stable_token with force_refresh=true, which
+// invalidates the previous token for every holder and is limited to 20 calls per day,
+// so it should only be used when a token is known to be leaked or broken.
+// With the legacy endpoint it behaves like GetAccessToken with reload set.
+// It always talks to WeChat directly, even when a custom AccessTokenProvider is configured.
+// Only a token that another replica cached after the call started is returned instead.
+func (w *Wechat) ForceRefreshAccessToken(ctx context.Context) (string, error) {
+	stale, _, err := w.cacheGet(ctx, cacheKindAccessToken)
+	if err != nil {
+		return "", err
+	}
+	result, err := w.refreshAccessToken(ctx, "force:"+stale, reuseExcept(stale), true)
+	if err != nil {
+		return "", err
 	}
-	token, err, _ := w.sf.Do(key, func() (any, error) {
-		resp, err := w.client.R().
+	return result.value, nil
+}
+
+// refreshResult is a refreshed token or ticket. issuedAt and expiresAt are zero when
+// the value was read back from the cache without its lifetime.
+type refreshResult struct {
+	value     string
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+// reusable reports whether a cached token or ticket can be returned instead of fetching
+// a new one.
+type reusable = func(cached *refreshResult) bool
+
+// reuseAny is the reusable of a lazy refresh, which reuses any cached value.
+func reuseAny(*refreshResult) bool { return true }
+
+// reuseExcept returns the reusable of a reload, which only reuses a value that replaced
+// stale, the value found to be bad, such as one cached by another replica meanwhile.
+func reuseExcept(stale string) reusable {
+	return func(cached *refreshResult) bool { return cached.value != stale }
+}
+
+// refreshAccessToken refreshes the access token unless reuse accepts the cached one.
+// Callers only share a refresh when they pass the same flight, so a lazy refresh is
+// never handed to a reload that rejects its result.
+func (w *Wechat) refreshAccessToken(ctx context.Context, flight string, reuse reusable, forceRefresh bool) (*refreshResult, error) {
+	key := cacheKindAccessToken
+	sfKey := key
+	if flight != "" {
+		sfKey = key + ":" + flight
+	}
+	return w.singleflight(ctx, key, sfKey, func(ctx context.Context) (*refreshResult, error) {
+		return w.refreshWithLock(ctx, key, reuse, func(ctx context.Context) (*refreshResult, error) {
+			return w.telemetry.refresh(ctx, key, func(ctx context.Context) (*refreshResult, error) {
+				result, err := w.fetchAccessToken(ctx, forceRefresh)
+				if err != nil {
+					return nil, err
+				}
+				return w.cacheSetRefreshed(ctx, key, result.AccessToken, time.Duration(result.ExpiresIn)*time.Second), nil
+			})
+		})
+	})
+}
+
+func (w *Wechat) fetchAccessToken(ctx context.Context, forceRefresh bool) (*AccessTokenResponse, error) {
+	var resp *resty.Response
+	var err error
+	if w.config.StableToken {
+		reqCtx := ctx
+		if forceRefresh {
+			reqCtx = withNoReplay(ctx) // a replay would invalidate the token again and use up the daily quota
+		}
+		resp, err = w.client.R().
+			Clone(reqCtx).
+			SetBody(map[string]any{
+				"grant_type":    "client_credential",
+				"appid":         w.config.AppID,
+				"secret":        w.config.AppSecret,
+				"force_refresh": forceRefresh,
+			}).
+			Post("/cgi-bin/stable_token")
+	} else {
+		resp, err = w.client.R().
 			Clone(ctx).
 			SetQueryParams(map[string]string{
 				"grant_type": "client_credential",
@@ -96,22 +460,13 @@ func (w *Wechat) GetAccessToken(ctx context.Context, reload bool) (string, error
 				"secret":     w.config.AppSecret,
 			}).
 			Get("/cgi-bin/token")
-		if err != nil {
-			return "", err
-		}
-		result, err := loadSuccessResponse(resp, func(a *AccessTokenResponse) error {
-			return checkResponseError(a.ErrCode, a.ErrMsg)
-		})
-		if err != nil {
-			return "", err
-		}
-		_ = w.cache.SetWithTTL(ctx, "AccessToken", result.AccessToken, time.Duration(result.ExpiresIn-2)*time.Second) // 提前2秒过期，避免在过期时请求失败
-		return result.AccessToken, nil
-	})
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return token.(string), nil
+	return loadSuccessResponse(resp, func(a *AccessTokenResponse) error {
+		return checkResponseError(a.ErrCode, a.ErrMsg)
+	})
 }
 
 // GetJsTicket retrieves a valid JS-SDK ticket for WeChat web applications.
@@ -124,56 +479,128 @@ func (w *Wechat) GetAccessToken(ctx context.Context, reload bool) (string, error
 //
 // Returns the JS ticket string or an error if retrieval fails.
 func (w *Wechat) GetJsTicket(ctx context.Context, reload bool) (string, error) {
-	key := "JsTicket"
-	if !reload {
-		token, exist, err := w.cache.Get(ctx, key)
-		if err != nil {
-			return "", err
-		}
+	return w.getTicket(ctx, cacheKindJsTicket, "wechat.GetJsTicket", reload)
+}
+
+// GetCardTicket retrieves a valid wx_card api_ticket, used to sign the card and coupon
+// interfaces of the JS-SDK. It is cached and refreshed like the jsapi ticket.
+func (w *Wechat) GetCardTicket(ctx context.Context, reload bool) (string, error) {
+	return w.getTicket(ctx, cacheKindCardTicket, "wechat.GetCardTicket", reload)
+}
+
+func (w *Wechat) getTicket(ctx context.Context, key, spanName string, reload bool) (ticket string, err error) {
+	ctx, span := w.telemetry.startSpan(ctx, spanName, key)
+	defer func() {
+		endSpan(span, err)
+	}()
+	token, exist, err := w.cacheGet(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	flight, reuse := "", reuseAny
+	if reload {
+		flight, reuse = "reload:"+token, reuseExcept(token)
+	} else {
+		w.telemetry.cacheLookup(ctx, key, exist)
 		if exist {
 			return token, nil
 		}
 	}
-	ticket, err, _ := w.sf.Do(key, func() (any, error) {
-		ticket, err := withAccessToken[JsTicketResponse](ctx, w, func(ctx context.Context, accessToken string) (*JsTicketResponse, error) {
-			resp, err := w.client.R().
-				Clone(ctx).
-				SetQueryParams(map[string]string{
-					"access_token": accessToken,
-					"type":         "jsapi",
-				}).
-				Get("/cgi-bin/ticket/getticket")
-			if err != nil {
-				return nil, err
-			}
-			return loadSuccessResponse(resp, func(a *JsTicketResponse) error {
-				return checkResponseError(a.ErrCode, a.ErrMsg)
+	result, err := w.refreshTicket(ctx, key, flight, reuse)
+	if err != nil {
+		return "", err
+	}
+	return result.value, nil
+}
+
+func (w *Wechat) refreshJsTicket(ctx context.Context, reuse reusable) (*refreshResult, error) {
+	return w.refreshTicket(ctx, cacheKindJsTicket, "", reuse)
+}
+
+// ticketTypes maps the ticket cache kinds to the type parameter of /cgi-bin/ticket/getticket.
+var ticketTypes = map[string]string{
+	cacheKindJsTicket:   "jsapi",
+	cacheKindCardTicket: "wx_card",
+}
+
+// refreshTicket refreshes the ticket of the cache kind key like refreshAccessToken.
+func (w *Wechat) refreshTicket(ctx context.Context, key, flight string, reuse reusable) (*refreshResult, error) {
+	sfKey := key
+	if flight != "" {
+		sfKey = key + ":" + flight
+	}
+	return w.singleflight(ctx, key, sfKey, func(ctx context.Context) (*refreshResult, error) {
+		return w.refreshWithLock(ctx, key, reuse, func(ctx context.Context) (*refreshResult, error) {
+			return w.telemetry.refresh(ctx, key, func(ctx context.Context) (*refreshResult, error) {
+				ticket, err := withAccessToken[JsTicketResponse](ctx, w, func(ctx context.Context, accessToken string) (*JsTicketResponse, error) {
+					resp, err := w.client.R().
+						Clone(ctx).
+						SetQueryParams(map[string]string{
+							"access_token": accessToken,
+							"type":         ticketTypes[key],
+						}).
+						Get("/cgi-bin/ticket/getticket")
+					if err != nil {
+						return nil, err
+					}
+					return loadSuccessResponse(resp, func(a *JsTicketResponse) error {
+						return checkResponseError(a.ErrCode, a.ErrMsg)
+					})
+				})
+				if err != nil {
+					return nil, err
+				}
+				return w.cacheSetRefreshed(ctx, key, ticket.Ticket, time.Duration(ticket.ExpiresIn)*time.Second), nil
 			})
 		})
-		if err != nil {
-			return nil, err
+	})
+}
+
+func withAccessToken[T any](ctx context.Context, w *Wechat, task func(ctx context.Context, accessToken string) (*T, error), options ...RequestOption) (*T, error) {
+	opts := newRequestOptions(options...)
+	policy := w.retryPolicy
+	if opts.nonIdempotent {
+		policy = NoRetry
+	}
+	if opts.retryPolicy != nil {
+		policy = *opts.retryPolicy
+	}
+	if opts.nonIdempotent {
+		call := task
+		task = func(ctx context.Context, accessToken string) (*T, error) {
+			return call(withNoReplay(ctx), accessToken)
 		}
-		_ = w.cache.SetWithTTL(ctx, key, ticket.Ticket, time.Duration(ticket.ExpiresIn-2)*time.Second) // 提前2秒过期，避免在过期时请求失败
-		return ticket, nil
+	}
+	resp, err := retry(ctx, policy, func() (*T, error) {
+		return withAccessTokenOnce(ctx, w, task, opts)
 	})
 	if err != nil {
-		return "", err
+		w.markQuotaExhausted(ctx, err)
+		return nil, err
 	}
-	return ticket.(*JsTicketResponse).Ticket, nil
+	return resp, nil
 }
 
-func withAccessToken[T any](ctx context.Context, w *Wechat, task func(ctx context.Context, accessToken string) (*T, error), options ...RequestOption) (*T, error) {
-	opts := newRequestOptions(options...)
-	token, err := w.GetAccessToken(ctx, opts.reloadAccessToken)
+// withAccessTokenOnce runs task with an access token, refreshing the token and running
+// task again once if WeChat rejects the token.
+func withAccessTokenOnce[T any](ctx context.Context, w *Wechat, task func(ctx context.Context, accessToken string) (*T, error), opts *requestOptions) (*T, error) {
+	tokenCtx := ctx
+	if opts.rejectedToken != "" {
+		tokenCtx = withRejectedToken(ctx, opts.rejectedToken)
+	}
+	token, err := w.GetAccessToken(tokenCtx, opts.reloadAccessToken)
 	if err != nil {
 		return nil, err
 	}
 	resp, err := task(ctx, token)
 	if err != nil {
 		if opts.retryable && isNeedRetryError(err) {
-			opts.retryable = false
-			opts.reloadAccessToken = true
-			return withAccessToken[T](ctx, w, task, WithClone(opts))
+			_ = w.tokens.InvalidateAccessToken(ctx, token)
+			retryOpts := newRequestOptions(WithClone(opts))
+			retryOpts.retryable = false
+			retryOpts.reloadAccessToken = true
+			retryOpts.rejectedToken = token
+			return withAccessTokenOnce(ctx, w, task, retryOpts)
 		}
 		return nil, err
 	}
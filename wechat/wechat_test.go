@@ -1,12 +1,20 @@
 package wechat
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/go-sphere/weixin-mp-api/wechat/wechattest"
 )
 
 var _ Cache = (*nopCache)(nil)
@@ -21,6 +29,14 @@ func (n *nopCache) SetWithTTL(ctx context.Context, key string, value string, ttl
 	return nil
 }
 
+func newTestWechat(t *testing.T, cache Cache, options ...Option) (*Wechat, *wechattest.Server) {
+	t.Helper()
+	srv := wechattest.NewServer()
+	t.Cleanup(srv.Close)
+	config := Config{AppID: srv.AppID, AppSecret: srv.AppSecret}
+	return NewWechat(config, cache, append([]Option{WithBaseURL(srv.URL)}, options...)...), srv
+}
+
 type testConfig struct {
 	WxMini Config `json:"wx_mini"`
 	Dash   struct {
@@ -60,6 +76,30 @@ func TestWechat_GetAccessToken(t *testing.T) {
 	t.Log(token)
 }
 
+func TestWechat_ShortLivedTokenNotCached(t *testing.T) {
+	cache := NewMemoryCache(0)
+	wx, srv := newTestWechat(t, cache)
+	srv.SetExpiresIn(1)
+	ctx := context.Background()
+	for range 2 {
+		token, err := wx.GetAccessToken(ctx, false)
+		if err != nil || token == "" {
+			t.Fatalf("GetAccessToken = %q, %v", token, err)
+		}
+	}
+	if _, ok, _ := cache.Get(ctx, "wechat:"+srv.AppID+":access_token"); ok {
+		t.Error("expected a token with expires_in 1 not to be cached")
+	}
+	if n := len(srv.Calls("/cgi-bin/token")); n != 2 {
+		t.Errorf("expected every call to fetch a new token, got %d token calls", n)
+	}
+	srv.SetExpiresIn(7200)
+	_, _ = wx.GetAccessToken(ctx, false)
+	if _, ok, _ := cache.Get(ctx, "wechat:"+srv.AppID+":access_token"); !ok {
+		t.Error("expected a long-lived token to be cached")
+	}
+}
+
 func TestWechat_SendMessageWithTemplate(t *testing.T) {
 	cfg, err := loadTestConfig()
 	if err != nil {
@@ -111,3 +151,263 @@ func TestWechat_SendMessageWithTemplate(t *testing.T) {
 		t.Log("Send message 2 success")
 	}
 }
+
+type recordingTransport struct {
+	mu         sync.Mutex
+	userAgents []string
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.userAgents = append(r.userAgents, req.Header.Get("User-Agent"))
+	r.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWechat_WithTransport(t *testing.T) {
+	transport := &recordingTransport{}
+	wx, _ := newTestWechat(t, &nopCache{}, WithTransport(transport), WithUserAgent("wechat-test/1.0"), WithTimeout(time.Second))
+	_, err := wx.GetAccessToken(context.Background(), false)
+	if err != nil {
+		t.Fatalf("failed to get access token: %v", err)
+	}
+	if len(transport.userAgents) != 1 || transport.userAgents[0] != "wechat-test/1.0" {
+		t.Errorf("unexpected transport calls: %v", transport.userAgents)
+	}
+}
+
+func TestWechat_SharedTransportUnchanged(t *testing.T) {
+	transport := &http.Transport{}
+	hc := &http.Client{Transport: transport}
+	config := Config{AppID: "wx123", AppSecret: "secret", Proxy: "http://127.0.0.1:3128"}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	NewWechat(config, &nopCache{}, WithHTTPClient(hc), WithTLSConfig(tlsConfig))
+	NewWechat(config, &nopCache{}, WithTransport(transport), WithTLSConfig(tlsConfig))
+	// Clone sets up HTTP/2 on the original, which fills in its TLSClientConfig, so only ours is checked
+	if hc.Transport != transport || transport.TLSClientConfig == tlsConfig || transport.Proxy != nil {
+		t.Errorf("expected the caller's transport to be left unchanged, got %+v", transport)
+	}
+}
+
+func TestWechat_SendMessage_RetriesInvalidCredential(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	srv.FailNext("/cgi-bin/message/subscribe/send", ErrCodeInvalidCredential, "invalid credential")
+	err := wx.SendMessage(context.Background(), &SubscribeMessageRequest{TemplateID: "tpl", ToUser: "openid"})
+	if err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if n := len(srv.Calls("/cgi-bin/message/subscribe/send")); n != 2 {
+		t.Errorf("expected 2 send calls, got %d", n)
+	}
+	if n := len(srv.Calls("/cgi-bin/token")); n != 2 {
+		t.Errorf("expected 2 token calls, got %d", n)
+	}
+}
+
+func TestWechat_GetQrCode_ExpiredToken(t *testing.T) {
+	wx, srv := newTestWechat(t, NewMemoryCache(0))
+	ctx := context.Background()
+	_, err := wx.GetAccessToken(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get access token: %v", err)
+	}
+	srv.ExpireTokens()
+	image, err := wx.GetQrCode(ctx, &QrCodeRequest{Scene: "a=1"})
+	if err != nil {
+		t.Fatalf("expected expired token to be refreshed, got %v", err)
+	}
+	if !bytes.Equal(image, wechattest.QrCodeImage) {
+		t.Errorf("unexpected image: %q", image)
+	}
+	if n := len(srv.Calls("/cgi-bin/token")); n != 2 {
+		t.Errorf("expected 2 token calls, got %d", n)
+	}
+}
+
+func TestWechat_GetQrCode_NoRetry(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	srv.FailNext("/wxa/getwxacodeunlimit", ErrCodeAccessTokenExpired, "access_token expired")
+	_, err := wx.GetQrCode(context.Background(), &QrCodeRequest{Scene: "a=1"}, WithRetryable(false))
+	if !errors.Is(err, ErrorAccessTokenExpired) {
+		t.Errorf("expected ErrorAccessTokenExpired, got %v", err)
+	}
+}
+
+func TestWechat_GetQrCode_Validation(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	ctx := context.Background()
+	cases := map[string]struct {
+		req  *QrCodeRequest
+		want error
+	}{
+		"empty scene":       {&QrCodeRequest{}, ErrorInvalidQrCodeScene},
+		"long scene":        {&QrCodeRequest{Scene: "0123456789012345678901234567890123"}, ErrorInvalidQrCodeScene},
+		"percent in scene":  {&QrCodeRequest{Scene: "a=%E4"}, ErrorInvalidQrCodeScene},
+		"chinese in scene":  {&QrCodeRequest{Scene: "id=中文"}, ErrorInvalidQrCodeScene},
+		"narrow":            {&QrCodeRequest{Scene: "a=1", Width: 100}, ErrorInvalidQrCodeWidth},
+		"wide":              {&QrCodeRequest{Scene: "a=1", Width: 2000}, ErrorInvalidQrCodeWidth},
+		"dark line color":   {&QrCodeRequest{Scene: "a=1", LineColor: &LineColor{R: -1}}, ErrorInvalidArgument},
+		"bright line color": {&QrCodeRequest{Scene: "a=1", LineColor: &LineColor{B: 256}}, ErrorInvalidArgument},
+		"special chars":     {&QrCodeRequest{Scene: "!#$&'()*+,/:;=?@-._~"}, nil},
+		"max length, width": {&QrCodeRequest{Scene: "01234567890123456789012345678901", Width: 1280, LineColor: &LineColor{R: 255, G: 255, B: 255}}, nil},
+	}
+	for name, tc := range cases {
+		_, err := wx.GetQrCode(ctx, tc.req)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+	if n := len(srv.Calls("/wxa/getwxacodeunlimit")); n != 2 {
+		t.Errorf("expected only valid requests to be sent, got %d calls", n)
+	}
+}
+
+func TestWechat_GetWxaCode(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	ctx := context.Background()
+	image, err := wx.GetWxaCode(ctx, &WxaCodeRequest{Path: "pages/index/index?foo=bar", LineColor: &LineColor{R: 255, G: 128}})
+	if err != nil || !bytes.Equal(image, wechattest.QrCodeImage) {
+		t.Fatalf("GetWxaCode = %q, %v", image, err)
+	}
+	var body map[string]any
+	_ = json.Unmarshal(srv.Calls("/wxa/getwxacode")[0].Body, &body)
+	if color, ok := body["line_color"].(map[string]any); !ok || color["r"] != 255.0 || color["g"] != 128.0 || color["b"] != 0.0 {
+		t.Errorf("expected line_color to be an rgb object, got %v", body["line_color"])
+	}
+	image, err = wx.CreateWxaQrCode(ctx, &WxaQrCodeRequest{Path: "pages/index/index?foo=bar", Width: 430})
+	if err != nil || !bytes.Equal(image, wechattest.QrCodeImage) {
+		t.Fatalf("CreateWxaQrCode = %q, %v", image, err)
+	}
+	// path limits are counted in bytes
+	prefix := "pages/index/index?q="
+	for name, tc := range map[string]struct {
+		path string
+		want error
+	}{
+		"max length":        {prefix + strings.Repeat("x", 128-len(prefix)), nil},
+		"too long":          {prefix + strings.Repeat("x", 129-len(prefix)), ErrorInvalidQrCodePath},
+		"multi-byte at max": {prefix + strings.Repeat("中", 36), nil},
+		"multi-byte":        {prefix + strings.Repeat("中", 37), ErrorInvalidQrCodePath},
+	} {
+		_, err = wx.CreateWxaQrCode(ctx, &WxaQrCodeRequest{Path: tc.path})
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s (%d bytes): expected %v, got %v", name, len(tc.path), tc.want, err)
+		}
+	}
+	_, err = wx.GetWxaCode(ctx, &WxaCodeRequest{Path: "pages/index/index?q=" + strings.Repeat("x", 1024)})
+	if !errors.Is(err, ErrorInvalidQrCodePath) {
+		t.Errorf("expected ErrorInvalidQrCodePath, got %v", err)
+	}
+	_, err = wx.GetWxaCode(ctx, &WxaCodeRequest{Path: "pages/index/index", Width: 279})
+	if !errors.Is(err, ErrorInvalidQrCodeWidth) {
+		t.Errorf("expected ErrorInvalidQrCodeWidth, got %v", err)
+	}
+	_, err = wx.GetWxaCode(ctx, &WxaCodeRequest{Path: "pages/index/index", LineColor: &LineColor{G: 300}})
+	if !errors.Is(err, ErrorInvalidArgument) {
+		t.Errorf("expected ErrorInvalidArgument for the line color, got %v", err)
+	}
+	if n := len(srv.Calls("/wxa/getwxacode")); n != 1 {
+		t.Errorf("expected only valid requests to be sent, got %d calls", n)
+	}
+}
+
+func TestWechat_JsCode2Session_Offline(t *testing.T) {
+	wx, srv := newTestWechat(t, &nopCache{})
+	ctx := context.Background()
+	session, err := wx.JsCode2Session(ctx, "code1")
+	if err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+	if session.OpenID != "openid-code1" || session.SessionKey != wechattest.SessionKey("code1") {
+		t.Errorf("unexpected session: %+v", session)
+	}
+
+	srv.FailNext("/sns/jscode2session", -1, "system error")
+	_, err = wx.JsCode2Session(ctx, "code2")
+	var errResp ErrResponse
+	if !errors.As(err, &errResp) || errResp.ErrCode != -1 {
+		t.Errorf("expected errcode -1, got %v", err)
+	}
+}
+
+func TestWechat_GetUserPhoneNumber_Offline(t *testing.T) {
+	wx, _ := newTestWechat(t, &nopCache{})
+	resp, err := wx.GetUserPhoneNumber(context.Background(), "code1")
+	if err != nil {
+		t.Fatalf("failed to get phone number: %v", err)
+	}
+	if resp.PhoneInfo.PhoneNumber != "13800000000" || resp.PhoneInfo.Watermark.Appid != wechattest.DefaultAppID {
+		t.Errorf("unexpected phone info: %+v", resp.PhoneInfo)
+	}
+}
+
+func TestWechat_StableToken(t *testing.T) {
+	srv := wechattest.NewServer()
+	t.Cleanup(srv.Close)
+	config := Config{AppID: srv.AppID, AppSecret: srv.AppSecret, StableToken: true}
+	wx1 := NewWechat(config, &nopCache{}, WithBaseURL(srv.URL))
+	wx2 := NewWechat(config, &nopCache{}, WithBaseURL(srv.URL))
+	ctx := context.Background()
+
+	token1, err := wx1.GetAccessToken(ctx, true)
+	if err != nil {
+		t.Fatalf("failed to get stable token: %v", err)
+	}
+	token2, err := wx2.GetAccessToken(ctx, true)
+	if err != nil {
+		t.Fatalf("failed to get stable token: %v", err)
+	}
+	if token1 != token2 {
+		t.Errorf("expected shared stable token, got %q and %q", token1, token2)
+	}
+	if n := len(srv.Calls("/cgi-bin/token")); n != 0 {
+		t.Errorf("expected no legacy token calls, got %d", n)
+	}
+
+	token3, err := wx1.ForceRefreshAccessToken(ctx)
+	if err != nil {
+		t.Fatalf("failed to force refresh stable token: %v", err)
+	}
+	if token3 == token1 {
+		t.Error("expected force refresh to issue a new token")
+	}
+	calls := srv.Calls("/cgi-bin/stable_token")
+	if !bytes.Contains(calls[len(calls)-1].Body, []byte(`"force_refresh":true`)) {
+		t.Errorf("expected force_refresh in request body, got %s", calls[len(calls)-1].Body)
+	}
+}
+
+type recordingTokenProvider struct {
+	srv         *wechattest.Server
+	reloads     int
+	invalidated []string
+}
+
+func (p *recordingTokenProvider) AccessToken(ctx context.Context, reload bool) (string, error) {
+	if reload {
+		p.reloads++
+	}
+	return p.srv.IssueAccessToken(), nil
+}
+
+func (p *recordingTokenProvider) InvalidateAccessToken(ctx context.Context, token string) error {
+	p.invalidated = append(p.invalidated, token)
+	return nil
+}
+
+func TestWechat_WithAccessTokenProvider(t *testing.T) {
+	provider := &recordingTokenProvider{}
+	wx, srv := newTestWechat(t, &nopCache{}, WithAccessTokenProvider(provider))
+	provider.srv = srv
+	srv.FailNext("/cgi-bin/message/subscribe/send", ErrCodeInvalidCredential, "invalid credential")
+	err := wx.SendMessage(context.Background(), &SubscribeMessageRequest{TemplateID: "tpl", ToUser: "openid"})
+	if err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if n := len(srv.Calls("/cgi-bin/token")); n != 0 {
+		t.Errorf("expected no token calls with a custom provider, got %d", n)
+	}
+	if len(provider.invalidated) != 1 || provider.reloads != 1 {
+		t.Errorf("expected one invalidation and one reload, got %v and %d", provider.invalidated, provider.reloads)
+	}
+}
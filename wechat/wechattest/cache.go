@@ -0,0 +1,159 @@
+package wechattest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Cache has the method set of wechat.Cache. It is redeclared here so that the wechat
+// package can use this package in its own tests.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, bool, error)
+	SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error
+}
+
+// Counter has the method set of wechat.Counter.
+type Counter interface {
+	IncrWithTTL(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+}
+
+// RunCacheTests runs the wechat.Cache conformance suite, including the wechat.Counter
+// tests if the cache implements it. newCache must return an empty
+// cache for every subtest; implementations backed by shared storage should isolate
+// subtests, for example with a per-test key prefix.
+func RunCacheTests(t *testing.T, newCache func(t *testing.T) Cache) {
+	ctx := context.Background()
+
+	t.Run("MissingKey", func(t *testing.T) {
+		c := newCache(t)
+		value, ok, err := c.Get(ctx, "missing")
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		if ok || value != "" {
+			t.Errorf("Get(missing) = %q, %v; want \"\", false", value, ok)
+		}
+	})
+
+	t.Run("SetGet", func(t *testing.T) {
+		c := newCache(t)
+		err := c.SetWithTTL(ctx, "key", "value", time.Minute)
+		if err != nil {
+			t.Fatalf("SetWithTTL returned error: %v", err)
+		}
+		value, ok, err := c.Get(ctx, "key")
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		if !ok || value != "value" {
+			t.Errorf("Get(key) = %q, %v; want \"value\", true", value, ok)
+		}
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		c := newCache(t)
+		_ = c.SetWithTTL(ctx, "key", "old", time.Minute)
+		err := c.SetWithTTL(ctx, "key", "new", time.Minute)
+		if err != nil {
+			t.Fatalf("SetWithTTL returned error: %v", err)
+		}
+		value, ok, _ := c.Get(ctx, "key")
+		if !ok || value != "new" {
+			t.Errorf("Get(key) = %q, %v; want \"new\", true", value, ok)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		c := newCache(t)
+		err := c.SetWithTTL(ctx, "short", "value", 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("SetWithTTL returned error: %v", err)
+		}
+		_ = c.SetWithTTL(ctx, "long", "value", time.Minute)
+		time.Sleep(100 * time.Millisecond)
+		if _, ok, _ := c.Get(ctx, "short"); ok {
+			t.Error("expected short-lived key to expire")
+		}
+		if _, ok, _ := c.Get(ctx, "long"); !ok {
+			t.Error("expected long-lived key to survive")
+		}
+	})
+
+	t.Run("IndependentKeys", func(t *testing.T) {
+		c := newCache(t)
+		_ = c.SetWithTTL(ctx, "wx1:access_token", "token1", time.Minute)
+		_ = c.SetWithTTL(ctx, "wx2:access_token", "token2", time.Minute)
+		v1, _, _ := c.Get(ctx, "wx1:access_token")
+		v2, _, _ := c.Get(ctx, "wx2:access_token")
+		if v1 != "token1" || v2 != "token2" {
+			t.Errorf("got %q and %q; want token1 and token2", v1, v2)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		c := newCache(t)
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				key := fmt.Sprintf("key%d", i%4)
+				for j := 0; j < 50; j++ {
+					if err := c.SetWithTTL(ctx, key, fmt.Sprintf("v%d", j), time.Minute); err != nil {
+						t.Errorf("SetWithTTL returned error: %v", err)
+						return
+					}
+					if _, _, err := c.Get(ctx, key); err != nil {
+						t.Errorf("Get returned error: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		for i := 0; i < 4; i++ {
+			if _, ok, _ := c.Get(ctx, fmt.Sprintf("key%d", i)); !ok {
+				t.Errorf("expected key%d to be present", i)
+			}
+		}
+	})
+
+	t.Run("Counter", func(t *testing.T) {
+		c := newCache(t)
+		counter, ok := c.(Counter)
+		if !ok {
+			t.Skip("cache does not implement Counter")
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 25; j++ {
+					if _, err := counter.IncrWithTTL(ctx, "counter", 1, time.Minute); err != nil {
+						t.Errorf("IncrWithTTL returned error: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		n, err := counter.IncrWithTTL(ctx, "counter", 0, time.Minute)
+		if err != nil || n != 200 {
+			t.Errorf("IncrWithTTL(counter, 0) = %d, %v; want 200, nil", n, err)
+		}
+		value, ok, _ := c.Get(ctx, "counter")
+		if !ok || value != "200" {
+			t.Errorf("Get(counter) = %q, %v; want \"200\", true", value, ok)
+		}
+		_, _ = counter.IncrWithTTL(ctx, "short", 1, 50*time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		n, _ = counter.IncrWithTTL(ctx, "short", 1, time.Minute)
+		if n != 1 {
+			t.Errorf("expected expired counter to restart at 1, got %d", n)
+		}
+	})
+}
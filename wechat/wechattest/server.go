@@ -0,0 +1,627 @@
+// Package wechattest provides an in-process fake of the WeChat API for offline tests.
+//
+// A Server emulates the endpoints used by the wechat package, issues access tokens that
+// expire like the real ones, records every call and lets tests script error codes:
+//
+//	srv := wechattest.NewServer()
+//	defer srv.Close()
+//	wx := wechat.NewWechat(wechat.Config{AppID: srv.AppID, AppSecret: srv.AppSecret}, cache, wechat.WithBaseURL(srv.URL))
+//	srv.FailNext("/cgi-bin/message/subscribe/send", 40001, "invalid credential")
+package wechattest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAppID is the AppID accepted by a new Server.
+	DefaultAppID = "wxtest0000000000"
+	// DefaultAppSecret is the AppSecret accepted by a new Server.
+	DefaultAppSecret = "wechattest-secret"
+	// DefaultExpiresIn is the lifetime in seconds of issued tokens and tickets.
+	DefaultExpiresIn = 7200
+	// DefaultDailyLimit is the daily call limit reported by /cgi-bin/openapi/quota/get.
+	DefaultDailyLimit = 100000
+)
+
+// QrCodeImage is the body returned by the fake mini-program code endpoints.
+var QrCodeImage = []byte("\x89PNG\r\n\x1a\nwechattest")
+
+// Call is a request received by the Server.
+type Call struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   []byte
+	Time   time.Time
+}
+
+// Failure is a scripted error response.
+type Failure struct {
+	ErrCode    int    // errcode in the JSON body
+	ErrMsg     string // errmsg in the JSON body
+	HTTPStatus int    // HTTP status, defaults to 200 like the real API
+}
+
+// ridPattern matches the request ID WeChat appends to errmsg.
+var ridPattern = regexp.MustCompile(`rid: ?([0-9a-zA-Z-]+)`)
+
+type ridRecord struct {
+	call     Call
+	response []byte
+}
+
+// Server is a fake WeChat API server backed by httptest.Server.
+type Server struct {
+	*httptest.Server
+	AppID     string
+	AppSecret string
+
+	mu        sync.Mutex
+	seq       int
+	expiresIn int
+	stable    string
+	tokens    map[string]time.Time
+	calls     []Call
+	failures  map[string][]Failure
+	handlers  map[string]http.HandlerFunc
+	rids      map[string]ridRecord
+	sessions  map[string]string
+	clearedAt time.Time
+}
+
+// NewServer starts a fake WeChat API server. Callers should Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		AppID:     DefaultAppID,
+		AppSecret: DefaultAppSecret,
+		expiresIn: DefaultExpiresIn,
+		tokens:    make(map[string]time.Time),
+		failures:  make(map[string][]Failure),
+		handlers:  make(map[string]http.HandlerFunc),
+		rids:      make(map[string]ridRecord),
+		sessions:  make(map[string]string),
+	}
+	s.handlers["/cgi-bin/token"] = s.handleToken
+	s.handlers["/cgi-bin/stable_token"] = s.handleStableToken
+	s.handlers["/cgi-bin/ticket/getticket"] = s.withAccessToken(s.handleTicket)
+	s.handlers["/sns/jscode2session"] = s.handleJsCode2Session
+	s.handlers["/sns/oauth2/access_token"] = s.handleSnsOauth2
+	s.handlers["/sns/oauth2/refresh_token"] = s.handleSnsRefresh
+	s.handlers["/sns/userinfo"] = s.withAccessToken(s.handleSnsUserInfo)
+	s.handlers["/sns/auth"] = s.withAccessToken(s.handleOK)
+	s.handlers["/wxa/checksession"] = s.withAccessToken(s.handleCheckSession)
+	s.handlers["/wxa/resetusersessionkey"] = s.withAccessToken(s.handleResetSessionKey)
+	s.handlers["/wxa/getwxacodeunlimit"] = s.withAccessToken(s.handleQrCode)
+	s.handlers["/wxa/getwxacode"] = s.withAccessToken(s.handleQrCode)
+	s.handlers["/cgi-bin/wxaapp/createwxaqrcode"] = s.withAccessToken(s.handleQrCode)
+	s.handlers["/cgi-bin/message/subscribe/send"] = s.withAccessToken(s.handleOK)
+	s.handlers["/wxa/business/getuserphonenumber"] = s.withAccessToken(s.handlePhoneNumber)
+	s.handlers["/cgi-bin/openapi/quota/get"] = s.withAccessToken(s.handleQuotaGet)
+	s.handlers["/cgi-bin/clear_quota"] = s.withAccessToken(s.handleClearQuota)
+	s.handlers["/cgi-bin/clear_quota/v2"] = s.handleClearQuotaV2
+	s.handlers["/cgi-bin/openapi/rid/get"] = s.withAccessToken(s.handleRidGet)
+	s.handlers["/cgi-bin/get_api_domain_ip"] = s.withAccessToken(s.handleAPIDomainIP)
+	s.handlers["/cgi-bin/callback/check"] = s.withAccessToken(s.handleCallbackCheck)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Handle installs h for path, replacing the built-in emulation if there is one.
+// Scripted failures and call recording still apply.
+func (s *Server) Handle(path string, h http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[path] = h
+}
+
+// HandleWithAccessToken is like Handle, but h only runs when the request carries a valid access_token.
+func (s *Server) HandleWithAccessToken(path string, h http.HandlerFunc) {
+	s.Handle(path, s.withAccessToken(h))
+}
+
+// FailNext makes the next call to path answer with errCode and errMsg. Calls queue up,
+// so FailNext can be called several times to script consecutive failures.
+func (s *Server) FailNext(path string, errCode int, errMsg string) {
+	s.FailNextWith(path, Failure{ErrCode: errCode, ErrMsg: errMsg})
+}
+
+// FailNextWith queues an arbitrary scripted failure for path.
+func (s *Server) FailNextWith(path string, failure Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], failure)
+}
+
+// SetExpiresIn sets the lifetime in seconds of tokens and tickets issued from now on.
+func (s *Server) SetExpiresIn(seconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expiresIn = seconds
+}
+
+// ExpireTokens expires every access token issued so far; using one yields errcode 42001.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token := range s.tokens {
+		s.tokens[token] = time.Time{}
+	}
+}
+
+// Calls returns the recorded calls to path, or all calls if path is empty.
+func (s *Server) Calls(path string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, c := range s.calls {
+		if path == "" || c.Path == path {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset clears recorded calls, rids and pending scripted failures.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+	s.failures = make(map[string][]Failure)
+	s.rids = make(map[string]ridRecord)
+}
+
+// IssueAccessToken issues a valid access token without going through /cgi-bin/token.
+func (s *Server) IssueAccessToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issueLocked("ACCESS_TOKEN")
+}
+
+func (s *Server) issueLocked(prefix string) string {
+	s.seq++
+	token := fmt.Sprintf("%s_%d", prefix, s.seq)
+	s.tokens[token] = time.Now().Add(time.Duration(s.expiresIn) * time.Second)
+	return token
+}
+
+func (s *Server) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	call := Call{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Body:   body,
+		Time:   time.Now(),
+	}
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	var failure *Failure
+	if queue := s.failures[r.URL.Path]; len(queue) > 0 {
+		failure = &queue[0]
+		s.failures[r.URL.Path] = queue[1:]
+	}
+	h := s.handlers[r.URL.Path]
+	s.mu.Unlock()
+
+	if failure != nil {
+		status := failure.HTTPStatus
+		if status == 0 {
+			status = http.StatusOK
+		}
+		resp := map[string]any{"errcode": failure.ErrCode, "errmsg": failure.ErrMsg}
+		if m := ridPattern.FindStringSubmatch(failure.ErrMsg); m != nil {
+			raw, _ := json.Marshal(resp)
+			s.mu.Lock()
+			s.rids[m[1]] = ridRecord{call: call, response: raw}
+			s.mu.Unlock()
+		}
+		WriteJSON(rw, status, resp)
+		return
+	}
+	if h == nil {
+		WriteError(rw, 40066, "invalid url")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	h(rw, r)
+}
+
+func (s *Server) withAccessToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+		if token == "" {
+			WriteError(rw, 41001, "access_token missing")
+			return
+		}
+		s.mu.Lock()
+		expiry, ok := s.tokens[token]
+		s.mu.Unlock()
+		switch {
+		case !ok:
+			WriteError(rw, 40001, "invalid credential, access_token is invalid or not latest")
+		case time.Now().After(expiry):
+			WriteError(rw, 42001, "access_token expired")
+		default:
+			h(rw, r)
+		}
+	}
+}
+
+func (s *Server) handleToken(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("grant_type") != "client_credential" {
+		WriteError(rw, 40002, "invalid grant_type")
+		return
+	}
+	if !s.checkCredential(rw, q.Get("appid"), q.Get("secret")) {
+		return
+	}
+	s.mu.Lock()
+	token, expiresIn := s.issueLocked("ACCESS_TOKEN"), s.expiresIn
+	s.mu.Unlock()
+	WriteJSON(rw, http.StatusOK, map[string]any{"access_token": token, "expires_in": expiresIn})
+}
+
+// handleStableToken keeps returning the current stable token until it expires or a
+// force_refresh replaces it, which also invalidates the old one.
+func (s *Server) handleStableToken(rw http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GrantType    string `json:"grant_type"`
+		AppID        string `json:"appid"`
+		Secret       string `json:"secret"`
+		ForceRefresh bool   `json:"force_refresh"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		WriteError(rw, 47001, "data format error")
+		return
+	}
+	if req.GrantType != "client_credential" {
+		WriteError(rw, 40002, "invalid grant_type")
+		return
+	}
+	if !s.checkCredential(rw, req.AppID, req.Secret) {
+		return
+	}
+	s.mu.Lock()
+	expiry, ok := s.tokens[s.stable]
+	if req.ForceRefresh || !ok || time.Now().After(expiry) {
+		delete(s.tokens, s.stable)
+		s.stable = s.issueLocked("STABLE_TOKEN")
+		expiry = s.tokens[s.stable]
+	}
+	token, expiresIn := s.stable, int(time.Until(expiry).Seconds())
+	s.mu.Unlock()
+	WriteJSON(rw, http.StatusOK, map[string]any{"access_token": token, "expires_in": expiresIn})
+}
+
+func (s *Server) handleTicket(rw http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.seq++
+	ticket, expiresIn := fmt.Sprintf("TICKET_%s_%d", r.URL.Query().Get("type"), s.seq), s.expiresIn
+	s.mu.Unlock()
+	WriteJSON(rw, http.StatusOK, map[string]any{"errcode": 0, "errmsg": "ok", "ticket": ticket, "expires_in": expiresIn})
+}
+
+func (s *Server) handleJsCode2Session(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !s.checkCredential(rw, q.Get("appid"), q.Get("secret")) {
+		return
+	}
+	code := q.Get("js_code")
+	if code == "" {
+		WriteError(rw, 40029, "invalid code")
+		return
+	}
+	s.mu.Lock()
+	s.sessions["openid-"+code] = SessionKey(code)
+	s.mu.Unlock()
+	WriteJSON(rw, http.StatusOK, map[string]any{
+		"openid":      "openid-" + code,
+		"unionid":     "unionid-" + code,
+		"session_key": SessionKey(code),
+	})
+}
+
+// checkSessionSignature reports whether the request is signed with the current session_key
+// of its openid, writing an error response otherwise.
+func (s *Server) checkSessionSignature(rw http.ResponseWriter, r *http.Request) bool {
+	q := r.URL.Query()
+	s.mu.Lock()
+	sessionKey, ok := s.sessions[q.Get("openid")]
+	s.mu.Unlock()
+	if q.Get("sig_method") != "hmac_sha256" {
+		WriteError(rw, 87009, "invalid sig_method")
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(sessionKey))
+	if !ok || !hmac.Equal([]byte(q.Get("signature")), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		WriteError(rw, 87009, "invalid signature")
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleCheckSession(rw http.ResponseWriter, r *http.Request) {
+	if s.checkSessionSignature(rw, r) {
+		WriteError(rw, 0, "ok")
+	}
+}
+
+func (s *Server) handleResetSessionKey(rw http.ResponseWriter, r *http.Request) {
+	if !s.checkSessionSignature(rw, r) {
+		return
+	}
+	openID := r.URL.Query().Get("openid")
+	s.mu.Lock()
+	s.seq++
+	sessionKey := SessionKey(fmt.Sprintf("reset-%d", s.seq))
+	s.sessions[openID] = sessionKey
+	s.mu.Unlock()
+	WriteJSON(rw, http.StatusOK, map[string]any{"errcode": 0, "errmsg": "ok", "openid": openID, "session_key": sessionKey})
+}
+
+func (s *Server) handleSnsOauth2(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !s.checkCredential(rw, q.Get("appid"), q.Get("secret")) {
+		return
+	}
+	code := q.Get("code")
+	if code == "" {
+		WriteError(rw, 40029, "invalid code")
+		return
+	}
+	s.mu.Lock()
+	token, expiresIn := s.issueLocked("SNS_TOKEN"), s.expiresIn
+	s.mu.Unlock()
+	WriteJSON(rw, http.StatusOK, map[string]any{
+		"access_token":  token,
+		"expires_in":    expiresIn,
+		"refresh_token": "REFRESH_" + code,
+		"openid":        "openid-" + code,
+		"scope":         "snsapi_userinfo",
+		"unionid":       "unionid-" + code,
+	})
+}
+
+func (s *Server) handleSnsRefresh(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("appid") != s.AppID {
+		WriteError(rw, 40013, "invalid appid")
+		return
+	}
+	code, ok := strings.CutPrefix(q.Get("refresh_token"), "REFRESH_")
+	if !ok || code == "" {
+		WriteError(rw, 40030, "invalid refresh_token")
+		return
+	}
+	s.mu.Lock()
+	token, expiresIn := s.issueLocked("SNS_TOKEN"), s.expiresIn
+	s.mu.Unlock()
+	WriteJSON(rw, http.StatusOK, map[string]any{
+		"access_token":  token,
+		"expires_in":    expiresIn,
+		"refresh_token": "REFRESH_" + code,
+		"openid":        "openid-" + code,
+		"scope":         "snsapi_userinfo",
+	})
+}
+
+func (s *Server) handleSnsUserInfo(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	openID := q.Get("openid")
+	if openID == "" {
+		WriteError(rw, 40003, "invalid openid")
+		return
+	}
+	nickname := "wechattest"
+	if q.Get("lang") == "en" {
+		nickname = "wechattest (en)"
+	}
+	WriteJSON(rw, http.StatusOK, map[string]any{
+		"openid":     openID,
+		"nickname":   nickname,
+		"sex":        0,
+		"country":    "CN",
+		"headimgurl": "https://thirdwx.qlogo.cn/mmopen/wechattest/132",
+		"privilege":  []string{},
+		"unionid":    "unionid-" + strings.TrimPrefix(openID, "openid-"),
+	})
+}
+
+func (s *Server) handleQrCode(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "image/png")
+	_, _ = rw.Write(QrCodeImage)
+}
+
+func (s *Server) handleOK(rw http.ResponseWriter, r *http.Request) {
+	WriteError(rw, 0, "ok")
+}
+
+func (s *Server) handlePhoneNumber(rw http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.Code == "" {
+		WriteError(rw, 40029, "invalid code")
+		return
+	}
+	WriteJSON(rw, http.StatusOK, map[string]any{
+		"errcode": 0,
+		"errmsg":  "ok",
+		"phone_info": map[string]any{
+			"phoneNumber":     "13800000000",
+			"purePhoneNumber": "13800000000",
+			"countryCode":     "86",
+			"watermark":       map[string]any{"timestamp": time.Now().Unix(), "appid": s.AppID},
+		},
+	})
+}
+
+// handleQuotaGet reports the calls made to cgi_path since the last quota reset.
+func (s *Server) handleQuotaGet(rw http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CgiPath string `json:"cgi_path"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.CgiPath == "" {
+		WriteError(rw, 40097, "invalid args")
+		return
+	}
+	s.mu.Lock()
+	var used int
+	for _, c := range s.calls {
+		if c.Path == req.CgiPath && !c.Time.Before(s.clearedAt) {
+			used++
+		}
+	}
+	s.mu.Unlock()
+	WriteJSON(rw, http.StatusOK, map[string]any{
+		"errcode": 0,
+		"errmsg":  "ok",
+		"quota": map[string]any{
+			"daily_limit": DefaultDailyLimit,
+			"used":        used,
+			"remain":      max(DefaultDailyLimit-used, 0),
+		},
+		"rate_limit":           map[string]any{"call_count": 1000, "refresh_second": 60},
+		"component_rate_limit": map[string]any{"call_count": 1000, "refresh_second": 60},
+	})
+}
+
+func (s *Server) handleClearQuota(rw http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AppID string `json:"appid"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.AppID != s.AppID {
+		WriteError(rw, 40013, "invalid appid")
+		return
+	}
+	s.clearQuota()
+	WriteError(rw, 0, "ok")
+}
+
+func (s *Server) handleClearQuotaV2(rw http.ResponseWriter, r *http.Request) {
+	if !s.checkCredential(rw, r.FormValue("appid"), r.FormValue("appsecret")) {
+		return
+	}
+	s.clearQuota()
+	WriteError(rw, 0, "ok")
+}
+
+func (s *Server) clearQuota() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearedAt = time.Now()
+}
+
+// handleRidGet describes the scripted failures whose errmsg carried a rid.
+func (s *Server) handleRidGet(rw http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rid string `json:"rid"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	s.mu.Lock()
+	record, ok := s.rids[req.Rid]
+	s.mu.Unlock()
+	if !ok {
+		WriteError(rw, 76001, "rid not found")
+		return
+	}
+	query := url.Values{}
+	for k, v := range record.call.Query {
+		if k != "access_token" {
+			query[k] = v
+		}
+	}
+	WriteJSON(rw, http.StatusOK, map[string]any{
+		"errcode": 0,
+		"errmsg":  "ok",
+		"request": map[string]any{
+			"invoke_time":   record.call.Time.Unix(),
+			"cost_in_ms":    1,
+			"request_url":   query.Encode(),
+			"request_body":  string(record.call.Body),
+			"response_body": string(record.response),
+			"client_ip":     "127.0.0.1",
+		},
+	})
+}
+
+func (s *Server) handleAPIDomainIP(rw http.ResponseWriter, r *http.Request) {
+	WriteJSON(rw, http.StatusOK, map[string]any{"ip_list": []string{"127.0.0.1"}})
+}
+
+func (s *Server) handleCallbackCheck(rw http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action        string `json:"action"`
+		CheckOperator string `json:"check_operator"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	operator := req.CheckOperator
+	if operator == "" || operator == "DEFAULT" {
+		operator = "CAP"
+	}
+	resp := map[string]any{"dns": []any{}, "ping": []any{}}
+	switch req.Action {
+	case "all", "dns", "ping":
+	default:
+		WriteError(rw, 40097, "invalid args")
+		return
+	}
+	if req.Action != "ping" {
+		resp["dns"] = []any{map[string]any{"ip": "127.0.0.1", "real_operator": operator}}
+	}
+	if req.Action != "dns" {
+		resp["ping"] = []any{map[string]any{"ip": "127.0.0.1", "from_operator": operator, "package_loss": "0%", "time": "0.050ms"}}
+	}
+	WriteJSON(rw, http.StatusOK, resp)
+}
+
+func (s *Server) checkCredential(rw http.ResponseWriter, appID, secret string) bool {
+	if appID != s.AppID {
+		WriteError(rw, 40013, "invalid appid")
+		return false
+	}
+	if secret != s.AppSecret {
+		WriteError(rw, 40125, "invalid appsecret")
+		return false
+	}
+	return true
+}
+
+// SessionKey returns the deterministic session_key the Server issues for a js_code.
+func SessionKey(code string) string {
+	key := make([]byte, 16)
+	copy(key, code)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// WriteJSON writes v as a JSON response with the given HTTP status.
+func WriteJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+// WriteError writes a WeChat style {"errcode","errmsg"} body with HTTP 200.
+func WriteError(rw http.ResponseWriter, errCode int, errMsg string) {
+	WriteJSON(rw, http.StatusOK, map[string]any{"errcode": errCode, "errmsg": errMsg})
+}
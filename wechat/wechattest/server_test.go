@@ -0,0 +1,226 @@
+package wechattest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type response struct {
+	status int
+	body   map[string]any
+}
+
+func (r response) errCode() int {
+	code, _ := r.body["errcode"].(float64)
+	return int(code)
+}
+
+func get(t *testing.T, srv *Server, path string, query url.Values) response {
+	t.Helper()
+	return do(t, srv, http.MethodGet, path, query, "")
+}
+
+func do(t *testing.T, srv *Server, method, path string, query url.Values, body string) response {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path+"?"+query.Encode(), strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var decoded map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&decoded)
+	return response{status: resp.StatusCode, body: decoded}
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func fetchToken(t *testing.T, srv *Server) string {
+	t.Helper()
+	resp := get(t, srv, "/cgi-bin/token", url.Values{
+		"grant_type": {"client_credential"},
+		"appid":      {srv.AppID},
+		"secret":     {srv.AppSecret},
+	})
+	token, _ := resp.body["access_token"].(string)
+	if token == "" {
+		t.Fatalf("expected an access token, got %v", resp.body)
+	}
+	return token
+}
+
+func TestServer_FailNext(t *testing.T) {
+	srv := newTestServer(t)
+	query := url.Values{"access_token": {srv.IssueAccessToken()}}
+	srv.FailNext("/cgi-bin/get_api_domain_ip", 45009, "reach max api daily quota limit")
+	srv.FailNextWith("/cgi-bin/get_api_domain_ip", Failure{ErrCode: -1, ErrMsg: "system error", HTTPStatus: http.StatusServiceUnavailable})
+
+	// failures of other paths are left alone
+	if resp := get(t, srv, "/sns/auth", query); resp.status != http.StatusOK || resp.errCode() != 0 {
+		t.Errorf("expected another path to succeed, got %d %v", resp.status, resp.body)
+	}
+	first := get(t, srv, "/cgi-bin/get_api_domain_ip", query)
+	if first.status != http.StatusOK || first.errCode() != 45009 || first.body["errmsg"] != "reach max api daily quota limit" {
+		t.Errorf("expected the first scripted failure, got %d %v", first.status, first.body)
+	}
+	second := get(t, srv, "/cgi-bin/get_api_domain_ip", query)
+	if second.status != http.StatusServiceUnavailable || second.errCode() != -1 {
+		t.Errorf("expected the second scripted failure, got %d %v", second.status, second.body)
+	}
+	third := get(t, srv, "/cgi-bin/get_api_domain_ip", query)
+	if third.status != http.StatusOK || third.errCode() != 0 || third.body["ip_list"] == nil {
+		t.Errorf("expected the built-in emulation once the queue is empty, got %d %v", third.status, third.body)
+	}
+}
+
+func TestServer_FailNextRid(t *testing.T) {
+	srv := newTestServer(t)
+	token := srv.IssueAccessToken()
+	srv.FailNext("/cgi-bin/message/subscribe/send", 43101, "user refuse to accept the msg rid: 64f1e6c6-1b2a3c4d-5e6f7a8b")
+	do(t, srv, http.MethodPost, "/cgi-bin/message/subscribe/send", url.Values{"access_token": {token}}, `{"touser":"openid"}`)
+
+	resp := do(t, srv, http.MethodPost, "/cgi-bin/openapi/rid/get", url.Values{"access_token": {token}}, `{"rid":"64f1e6c6-1b2a3c4d-5e6f7a8b"}`)
+	request, _ := resp.body["request"].(map[string]any)
+	if resp.errCode() != 0 || request["request_body"] != `{"touser":"openid"}` || strings.Contains(request["request_url"].(string), token) {
+		t.Errorf("unexpected rid record %v", resp.body)
+	}
+	if resp := do(t, srv, http.MethodPost, "/cgi-bin/openapi/rid/get", url.Values{"access_token": {token}}, `{"rid":"unknown"}`); resp.errCode() != 76001 {
+		t.Errorf("expected errcode 76001 for an unknown rid, got %v", resp.body)
+	}
+}
+
+func TestServer_Calls(t *testing.T) {
+	srv := newTestServer(t)
+	start := time.Now()
+	token := fetchToken(t, srv)
+	do(t, srv, http.MethodPost, "/wxa/getwxacode", url.Values{"access_token": {token}}, `{"path":"pages/index/index"}`)
+	get(t, srv, "/unknown", nil)
+
+	all := srv.Calls("")
+	if len(all) != 3 {
+		t.Fatalf("expected 3 recorded calls, got %d", len(all))
+	}
+	for i, path := range []string{"/cgi-bin/token", "/wxa/getwxacode", "/unknown"} {
+		if all[i].Path != path {
+			t.Errorf("call %d: expected %s, got %s", i, path, all[i].Path)
+		}
+		if all[i].Time.Before(start) || (i > 0 && all[i].Time.Before(all[i-1].Time)) {
+			t.Errorf("call %d: unexpected time %v", i, all[i].Time)
+		}
+	}
+	calls := srv.Calls("/wxa/getwxacode")
+	if len(calls) != 1 || calls[0].Method != http.MethodPost || calls[0].Query.Get("access_token") != token || string(calls[0].Body) != `{"path":"pages/index/index"}` {
+		t.Errorf("unexpected recorded call %+v", calls)
+	}
+	if calls := srv.Calls("/cgi-bin/ticket/getticket"); len(calls) != 0 {
+		t.Errorf("expected no calls to an unused path, got %d", len(calls))
+	}
+
+	srv.FailNext("/unknown", -1, "system error")
+	srv.Reset()
+	if n := len(srv.Calls("")); n != 0 {
+		t.Errorf("expected Reset to clear the calls, got %d", n)
+	}
+	if resp := get(t, srv, "/unknown", nil); resp.errCode() != 40066 {
+		t.Errorf("expected Reset to drop pending failures, got %v", resp.body)
+	}
+}
+
+func TestServer_CallsConcurrent(t *testing.T) {
+	srv := newTestServer(t)
+	query := url.Values{"access_token": {srv.IssueAccessToken()}}
+	for i := 0; i < 5; i++ {
+		srv.FailNext("/cgi-bin/get_api_domain_ip", -1, "system error")
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(srv.URL + "/cgi-bin/get_api_domain_ip?" + query.Encode())
+			if err != nil {
+				t.Errorf("request failed: %v", err)
+				return
+			}
+			defer func() { _ = resp.Body.Close() }()
+			var body struct {
+				ErrCode int `json:"errcode"`
+			}
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			if body.ErrCode != 0 {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(srv.Calls("/cgi-bin/get_api_domain_ip")); n != 20 || failed != 5 {
+		t.Errorf("expected 20 calls with 5 failures, got %d calls and %d failures", n, failed)
+	}
+}
+
+func TestServer_AccessTokens(t *testing.T) {
+	srv := newTestServer(t)
+	resp := get(t, srv, "/cgi-bin/token", url.Values{"grant_type": {"client_credential"}, "appid": {srv.AppID}, "secret": {"wrong"}})
+	if resp.errCode() != 40125 {
+		t.Errorf("expected errcode 40125 for a wrong secret, got %v", resp.body)
+	}
+	token := fetchToken(t, srv)
+	if resp := get(t, srv, "/cgi-bin/get_api_domain_ip", url.Values{"access_token": {"bogus"}}); resp.errCode() != 40001 {
+		t.Errorf("expected errcode 40001 for an unknown token, got %v", resp.body)
+	}
+	if resp := get(t, srv, "/cgi-bin/get_api_domain_ip", url.Values{"access_token": {token}}); resp.errCode() != 0 {
+		t.Errorf("expected the issued token to be accepted, got %v", resp.body)
+	}
+	srv.ExpireTokens()
+	if resp := get(t, srv, "/cgi-bin/get_api_domain_ip", url.Values{"access_token": {token}}); resp.errCode() != 42001 {
+		t.Errorf("expected errcode 42001 for an expired token, got %v", resp.body)
+	}
+}
+
+type mapCache struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func (c *mapCache) Get(ctx context.Context, key string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if expiry, ok := c.expires[key]; ok && time.Now().After(expiry) {
+		return "", false, nil
+	}
+	value, ok := c.values[key]
+	return value, ok, nil
+}
+
+func (c *mapCache) SetWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+	c.expires[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func TestRunCacheTests(t *testing.T) {
+	RunCacheTests(t, func(t *testing.T) Cache {
+		return &mapCache{values: make(map[string]string), expires: make(map[string]time.Time)}
+	})
+}